@@ -0,0 +1,324 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"strings"
+)
+
+// Attachment describes a named part of the binary data of a call. The
+// parts follow each other in the order of the list. The optional digest
+// is "algo:hex", as Digest.String returns, and is verified by the
+// receiver.
+type Attachment struct {
+	Name   string `json:"name"             msgpack:"name"`
+	Size   int64  `json:"size"             msgpack:"size"`
+	Type   string `json:"type,omitempty"   msgpack:"type,omitempty"`
+	Digest string `json:"digest,omitempty" msgpack:"digest,omitempty"`
+}
+
+// AttachmentReader is an attachment to send with the reader of its data.
+type AttachmentReader struct {
+	Attachment
+	Reader io.Reader
+}
+
+// AttachmentFunc returns the writer of a received attachment. A nil
+// writer discards the attachment.
+type AttachmentFunc func(attachment Attachment) (io.Writer, error)
+
+func withAttachments(list []Attachment) CallOption {
+	return func(content *Content) {
+		content.reqBlock.Attachments = list
+	}
+}
+
+// PutAttachments uploads the attachments in one call.
+func PutAttachments(ctx context.Context, address string, method string, attachments []AttachmentReader, param, result any, auth *Auth, opts ...CallOption) error {
+	var err error
+
+	conn, err := dial(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return ConnPutAttachments(ctx, conn, method, attachments, param, result, auth, opts...)
+}
+
+func ConnPutAttachments(ctx context.Context, conn net.Conn, method string, attachments []AttachmentReader, param, result any, auth *Auth, opts ...CallOption) error {
+	list, reader, binSize := attachmentsOf(attachments)
+	opts = append([]CallOption{withAttachments(list)}, opts...)
+	return ConnPut(ctx, conn, method, reader, binSize, param, result, auth, opts...)
+}
+
+// GetAttachments downloads the attachments of the response into the
+// writers returned by writers.
+func GetAttachments(ctx context.Context, address string, method string, writers AttachmentFunc, param, result any, auth *Auth, opts ...CallOption) error {
+	var err error
+
+	conn, err := dial(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return ConnGetAttachments(ctx, conn, method, writers, param, result, auth, opts...)
+}
+
+func ConnGetAttachments(ctx context.Context, conn net.Conn, method string, writers AttachmentFunc, param, result any, auth *Auth, opts ...CallOption) error {
+	var err error
+
+	content := CreateContent(conn)
+	content.applyOptions(opts)
+	content.reqBlock.Method = method
+	if param != nil {
+		content.reqBlock.Params = param
+	}
+	if auth != nil {
+		content.reqBlock.Auth = auth
+	}
+	if result != nil {
+		content.resBlock.Result = result
+	}
+
+	err = content.createRequest(ctx)
+	if err != nil {
+		return err
+	}
+	stop := content.watchContext(ctx, conn)
+	defer stop()
+
+	err = content.writeRequest()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	content.inputDone.Store(true)
+
+	err = content.readResponse()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	// The list of the attachments is needed before the data.
+	err = content.bindResponse()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	err = content.downloadAttachments(ctx, writers)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	err = content.readTrailer()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	return err
+}
+
+func (content *Content) downloadAttachments(ctx context.Context, writers AttachmentFunc) error {
+	var err error
+	list := content.resBlock.Attachments
+	err = checkAttachments(list, content.resHeader.binSize)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 && content.resHeader.binSize != 0 {
+		list = []Attachment{{Size: content.resHeader.binSize}}
+	}
+	reader, err := binInputOf(content.resHeader, content.sockReader, &content.resBinWire)
+	if err != nil {
+		return err
+	}
+	if content.resHash != nil {
+		reader = io.TeeReader(reader, content.resHash)
+	}
+	for _, attachment := range list {
+		writer, err := writers(attachment)
+		if err != nil {
+			return err
+		}
+		if writer == nil {
+			writer = io.Discard
+		}
+		part, err := newAttachmentReader(reader, attachment)
+		if err != nil {
+			return err
+		}
+		_, err = CopyBytes(ctx, part, writer, attachment.Size)
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// Attachments returns the attachments of the request.
+func (content *Content) Attachments() []Attachment {
+	return content.reqBlock.Attachments
+}
+
+// NextAttachment returns the next attachment of the request and the
+// reader of its data, or io.EOF after the last one. The unread data of
+// the previous attachment is skipped. Binary data sent without the list
+// of attachments is returned as one unnamed attachment.
+func (content *Content) NextAttachment() (Attachment, io.Reader, error) {
+	var err error
+	if content.attachInput != nil {
+		_, err = io.Copy(io.Discard, content.attachInput)
+		if err != nil {
+			return Attachment{}, nil, err
+		}
+	}
+	list := content.reqBlock.Attachments
+	if len(list) == 0 && content.reqHeader.binSize != 0 {
+		list = []Attachment{{Size: content.reqHeader.binSize}}
+	}
+	if content.attachIndex >= len(list) {
+		content.watchConn()
+		return Attachment{}, nil, io.EOF
+	}
+	attachment := list[content.attachIndex]
+	content.attachIndex++
+	reader := &contextReader{ctx: content.Context(), reader: content.BinReader()}
+	content.attachInput, err = newAttachmentReader(reader, attachment)
+	if err != nil {
+		return Attachment{}, nil, err
+	}
+	return attachment, content.attachInput, err
+}
+
+// SendAttachments sends the result followed by the attachments.
+func (content *Content) SendAttachments(result any, attachments ...AttachmentReader) error {
+	var err error
+	list, reader, binSize := attachmentsOf(attachments)
+	content.resBlock.Attachments = list
+	err = content.SendResult(result, binSize)
+	if err != nil {
+		return err
+	}
+	if binSize == 0 {
+		return err
+	}
+	writer := content.binStream()
+	_, err = CopyBytes(content.Context(), reader, writer, binSize)
+	if err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// attachmentsOf returns the list of the attachments and the reader of
+// their data.
+func attachmentsOf(attachments []AttachmentReader) ([]Attachment, io.Reader, int64) {
+	list := make([]Attachment, 0, len(attachments))
+	readers := make([]io.Reader, 0, len(attachments))
+	var binSize int64
+	for _, attachment := range attachments {
+		list = append(list, attachment.Attachment)
+		readers = append(readers, &sizedReader{reader: attachment.Reader, remains: attachment.Size})
+		binSize += attachment.Size
+	}
+	return list, io.MultiReader(readers...), binSize
+}
+
+func checkAttachments(list []Attachment, binSize int64) error {
+	var err error
+	if len(list) == 0 {
+		return err
+	}
+	var total int64
+	for _, attachment := range list {
+		if attachment.Size < 0 {
+			err = fmt.Errorf("wrong size of attachment %s", attachment.Name)
+			return err
+		}
+		total += attachment.Size
+	}
+	// The size of chunked data is known at its end only.
+	if total != binSize && binSize != ChunkedSize {
+		err = fmt.Errorf("attachments size %d mismatch binary size %d", total, binSize)
+		return err
+	}
+	return err
+}
+
+// sizedReader reads exactly the size of the data from the reader.
+type sizedReader struct {
+	reader  io.Reader
+	remains int64
+}
+
+func (reader *sizedReader) Read(buffer []byte) (int, error) {
+	if reader.remains == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(buffer)) > reader.remains {
+		buffer = buffer[0:reader.remains]
+	}
+	read, err := reader.reader.Read(buffer)
+	reader.remains -= int64(read)
+	if err == io.EOF && reader.remains > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return read, err
+}
+
+// attachmentReader reads the data of one attachment and verifies its
+// digest together with the last byte.
+type attachmentReader struct {
+	sizedReader
+	hash hash.Hash
+	sum  []byte
+}
+
+func newAttachmentReader(reader io.Reader, attachment Attachment) (*attachmentReader, error) {
+	var err error
+	part := &attachmentReader{
+		sizedReader: sizedReader{reader: reader, remains: attachment.Size},
+	}
+	if len(attachment.Digest) == 0 {
+		return part, err
+	}
+	algo, sum, _ := strings.Cut(attachment.Digest, ":")
+	part.hash, err = newDigest(algo)
+	if err != nil {
+		return nil, err
+	}
+	part.sum, err = hex.DecodeString(sum)
+	if err != nil {
+		err = fmt.Errorf("wrong digest of attachment %s", attachment.Name)
+		return nil, err
+	}
+	return part, err
+}
+
+func (part *attachmentReader) Read(buffer []byte) (int, error) {
+	if part.remains < 0 {
+		// The single attachment of a stream of unknown length.
+		return part.reader.Read(buffer)
+	}
+	read, err := part.sizedReader.Read(buffer)
+	if part.hash == nil {
+		return read, err
+	}
+	part.hash.Write(buffer[0:read])
+	if part.remains == 0 {
+		if !bytes.Equal(part.hash.Sum(nil), part.sum) {
+			err = ErrDigestMismatch
+		}
+		part.hash = nil
+	}
+	return read, err
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	attachPutMethod string = "attachPut"
+	attachGetMethod string = "attachGet"
+)
+
+var attachFiles = map[string][]byte{
+	"photo.jpg":  bytes.Repeat([]byte("photo "), 40000),
+	"thumb.jpg":  []byte("thumb"),
+	"photo.json": []byte(`{"width":1024}`),
+}
+
+func attachReaders(names ...string) []AttachmentReader {
+	attachments := make([]AttachmentReader, 0)
+	for _, name := range names {
+		data := attachFiles[name]
+		sum := sha256.Sum256(data)
+		attachment := AttachmentReader{
+			Attachment: Attachment{
+				Name:   name,
+				Size:   int64(len(data)),
+				Type:   "application/octet-stream",
+				Digest: DigestSHA256 + ":" + hex.EncodeToString(sum[:]),
+			},
+			Reader: bytes.NewReader(data),
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments
+}
+
+// attachPutHandler reads all attachments but thumbnails, which are
+// skipped, and returns their names.
+func attachPutHandler(content *Content) error {
+	names := make([]string, 0)
+	for {
+		attachment, reader, err := content.NextAttachment()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		names = append(names, attachment.Name)
+		if strings.HasPrefix(attachment.Name, "thumb") {
+			continue
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(attachFiles[attachment.Name], data) {
+			return io.ErrUnexpectedEOF
+		}
+	}
+	result := &HelloResult{Message: strings.Join(names, ",")}
+	return content.SendResult(result, 0)
+}
+
+func attachGetHandler(content *Content) error {
+	attachments := attachReaders("photo.jpg", "thumb.jpg", "photo.json")
+	if content.Metadata().Get("corrupt") == "yes" {
+		attachments[1].Digest = DigestSHA256 + ":00"
+	}
+	return content.SendAttachments(&HelloResult{Message: "sent"}, attachments...)
+}
+
+func TestAttachments(t *testing.T) {
+	serv := NewService()
+	serv.Handler(attachPutMethod, attachPutHandler)
+	serv.Handler(attachGetMethod, attachGetHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := &HelloResult{}
+	attachments := attachReaders("photo.jpg", "thumb.jpg", "photo.json")
+	err := PutAttachments(ctx, address, attachPutMethod, attachments, nil, result, nil,
+		WithDigest(DigestCRC32C, nil))
+	require.NoError(t, err)
+	require.Equal(t, "photo.jpg,thumb.jpg,photo.json", result.Message)
+
+	attachments = attachReaders("photo.jpg")
+	attachments[0].Digest = DigestSHA256 + ":00"
+	err = PutAttachments(ctx, address, attachPutMethod, attachments, nil, result, nil)
+	require.Error(t, err)
+
+	for _, opt := range []CallOption{WithCodec(MsgpackCodec), WithCodec(GobCodec), WithCompression(GzipCompressor)} {
+		received := make(map[string]*bytes.Buffer)
+		writers := func(attachment Attachment) (io.Writer, error) {
+			if attachment.Name == "thumb.jpg" {
+				return nil, nil
+			}
+			received[attachment.Name] = bytes.NewBuffer(nil)
+			return received[attachment.Name], nil
+		}
+		err = GetAttachments(ctx, address, attachGetMethod, writers, nil, result, nil, opt)
+		require.NoError(t, err)
+		require.Equal(t, "sent", result.Message)
+		require.Len(t, received, 2)
+		require.Equal(t, attachFiles["photo.jpg"], received["photo.jpg"].Bytes())
+		require.Equal(t, attachFiles["photo.json"], received["photo.json"].Bytes())
+	}
+
+	discard := func(attachment Attachment) (io.Writer, error) {
+		return io.Discard, nil
+	}
+	err = GetAttachments(ctx, address, attachGetMethod, discard, nil, result, nil,
+		WithMetadata(NewMetadata("corrupt", "yes")))
+	require.ErrorIs(t, err, ErrDigestMismatch)
+}
+
+func TestCheckAttachments(t *testing.T) {
+	list := []Attachment{{Name: "a", Size: 2}, {Name: "b", Size: 3}}
+	require.NoError(t, checkAttachments(list, 5))
+	require.NoError(t, checkAttachments(nil, 5))
+	require.Error(t, checkAttachments(list, 4))
+	require.Error(t, checkAttachments([]Attachment{{Name: "a", Size: -1}}, -1))
+
+	// A reader shorter than the attachment size fails.
+	attachments := []AttachmentReader{
+		{Attachment: Attachment{Name: "a", Size: 4}, Reader: strings.NewReader("abc")},
+		{Attachment: Attachment{Name: "b", Size: 1}, Reader: strings.NewReader("d")},
+	}
+	_, reader, binSize := attachmentsOf(attachments)
+	require.Equal(t, int64(5), binSize)
+	_, err := io.ReadAll(reader)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,329 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	// DefaultMaxBatchSize is the largest number of the calls of a batch
+	// served by a service.
+	DefaultMaxBatchSize int = 1000
+	// DefaultBatchParallelism is the number of the calls of a parallel
+	// batch which run at once.
+	DefaultBatchParallelism int = 16
+)
+
+// Batch is an ordered list of calls sent in one request. The server runs
+// the calls one after another, or at once if Parallel is set, and
+// answers each of them with its own result or error.
+type Batch struct {
+	Calls    []*BatchCall
+	Parallel bool
+}
+
+// BatchCall is a call of a batch. Err and Header are set when the batch
+// is executed.
+type BatchCall struct {
+	Method string
+	Params any
+	Result any
+	Meta   Metadata
+	Header Metadata
+	Err    error
+}
+
+func NewBatch(parallel bool) *Batch {
+	return &Batch{
+		Calls:    make([]*BatchCall, 0),
+		Parallel: parallel,
+	}
+}
+
+// Add appends a call of the method to the batch. The result is decoded
+// into result when the batch is executed.
+func (batch *Batch) Add(method string, params, result any) *BatchCall {
+	call := &BatchCall{
+		Method: method,
+		Params: params,
+		Result: result,
+	}
+	batch.Calls = append(batch.Calls, call)
+	return call
+}
+
+// Err returns the error of the first failed call of the batch.
+func (batch *Batch) Err() error {
+	for _, call := range batch.Calls {
+		if call.Err != nil {
+			return call.Err
+		}
+	}
+	return nil
+}
+
+// batchBlock is the request params of a batch.
+type batchBlock struct {
+	Parallel bool         `json:"parallel"        msgpack:"parallel"`
+	Calls    []batchEntry `json:"calls"           msgpack:"calls"`
+}
+
+type batchEntry struct {
+	Method string   `json:"method"            msgpack:"method"`
+	Params rawValue `json:"params,omitempty"  msgpack:"params"`
+	Meta   Metadata `json:"meta,omitempty"    msgpack:"meta,omitempty"`
+}
+
+// batchReply is the response of a call of a batch.
+type batchReply struct {
+	Error  string       `json:"error,omitempty"   msgpack:"error,omitempty"`
+	Fields []FieldError `json:"fields,omitempty"  msgpack:"fields,omitempty"`
+	Result rawValue     `json:"result,omitempty"  msgpack:"result"`
+	Header Metadata     `json:"header,omitempty"  msgpack:"header,omitempty"`
+}
+
+// ExecBatch executes the calls of the batch in one round trip. The
+// returned error is the error of the whole batch, the errors of the calls
+// are set to their Err.
+func ExecBatch(ctx context.Context, address string, batch *Batch, auth *Auth, opts ...CallOption) error {
+	var err error
+
+	conn, err := dial(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return ConnExecBatch(ctx, conn, batch, auth, opts...)
+}
+
+func ConnExecBatch(ctx context.Context, conn net.Conn, batch *Batch, auth *Auth, opts ...CallOption) error {
+	var err error
+	if len(batch.Calls) == 0 {
+		return err
+	}
+
+	content := CreateContent(conn)
+	content.applyOptions(opts)
+	block := &batchBlock{
+		Parallel: batch.Parallel,
+		Calls:    make([]batchEntry, 0, len(batch.Calls)),
+	}
+	for _, call := range batch.Calls {
+		err = checkMetadata(call.Meta)
+		if err != nil {
+			return err
+		}
+		params := call.Params
+		if params == nil {
+			params = NewEmptyParams()
+		}
+		entry := batchEntry{
+			Method: call.Method,
+			Meta:   call.Meta,
+		}
+		entry.Params, err = encodeValue(content.codec, params)
+		if err != nil {
+			return err
+		}
+		block.Calls = append(block.Calls, entry)
+	}
+	replies := make([]batchReply, 0)
+	content.reqBlock.Params = block
+	content.resBlock.Result = &replies
+	if auth != nil {
+		content.reqBlock.Auth = auth
+	}
+	content.reqHeader.setFlag(flagBatch)
+
+	err = content.createRequest(ctx)
+	if err != nil {
+		return err
+	}
+	stop := content.watchContext(ctx, conn)
+	defer stop()
+
+	err = content.writeRequest()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	content.inputDone.Store(true)
+
+	err = content.readResponse()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	err = content.bindResponse()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	if len(replies) != len(batch.Calls) {
+		err = errors.New("wrong number of batch replies")
+		return err
+	}
+	codec, err := codecById(content.resHeader.codecId())
+	if err != nil {
+		return err
+	}
+	for i, call := range batch.Calls {
+		call.bindReply(codec, &replies[i])
+	}
+	return err
+}
+
+// bindReply sets the result, the header and the error of the call.
+func (call *BatchCall) bindReply(codec Codec, reply *batchReply) {
+	call.Header = reply.Header
+	call.Err = nil
+	if len(reply.Fields) > 0 {
+		call.Err = &ValidationError{Fields: reply.Fields}
+		return
+	}
+	if len(reply.Error) > 0 {
+		call.Err = errors.New(reply.Error)
+		return
+	}
+	if call.Result != nil {
+		call.Err = decodeValue(codec, reply.Result, call.Result)
+	}
+}
+
+// SetBatchLimits sets the largest number of the calls of a batch and the
+// number of the calls of a parallel batch which run at once.
+func (svc *Service) SetBatchLimits(maxSize, parallelism int) {
+	svc.batchMax = maxSize
+	svc.batchRuns = parallelism
+}
+
+// serveBatch runs the calls of a batch request and sends their replies.
+// Each call runs with the middleware of the service as a call of its own.
+func (svc *Service) serveBatch(content *Content) error {
+	var err error
+	block := &batchBlock{}
+	err = decodeValue(content.codec, content.reqParams, block)
+	if err != nil {
+		content.sendBatchError(err)
+		return err
+	}
+	if len(block.Calls) > svc.batchMax {
+		err = fmt.Errorf("batch exceeds %d calls", svc.batchMax)
+		content.sendBatchError(err)
+		return err
+	}
+	replies := make([]batchReply, len(block.Calls))
+	if block.Parallel {
+		// A pool of workers runs the calls.
+		workers := svc.batchRuns
+		if workers < 1 {
+			workers = 1
+		}
+		if workers > len(block.Calls) {
+			workers = len(block.Calls)
+		}
+		indexes := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range indexes {
+					replies[i] = svc.serveEntry(content, &block.Calls[i])
+				}
+			}()
+		}
+		for i := range block.Calls {
+			indexes <- i
+		}
+		close(indexes)
+		wg.Wait()
+	} else {
+		for i := range block.Calls {
+			replies[i] = svc.serveEntry(content, &block.Calls[i])
+		}
+	}
+	return content.SendResult(replies, 0)
+}
+
+// sendBatchError sends the error of the whole batch. The result is an
+// empty list of replies, so that the client can decode it.
+func (content *Content) sendBatchError(execErr error) error {
+	content.resBlock.Error = execErr.Error()
+	return content.SendResult(make([]batchReply, 0), 0)
+}
+
+// serveEntry runs a call of a batch and returns its reply.
+func (svc *Service) serveEntry(batch *Content, entry *batchEntry) (reply batchReply) {
+	content := batch.entryContent(entry)
+	defer content.closeContext()
+	defer func() {
+		panicMsg := recover()
+		if panicMsg != nil {
+			logError("handler panic message:", panicMsg)
+			reply = batchReply{Error: "handler panic"}
+		}
+	}()
+
+	svc.serve(content)
+	resBlock := content.resBlock
+	reply.Error = resBlock.Error
+	reply.Fields = resBlock.Fields
+	reply.Header = resBlock.Header
+	if len(reply.Error) > 0 {
+		return reply
+	}
+	result, err := encodeValue(content.codec, resBlock.Result)
+	if err != nil {
+		reply.Error = err.Error()
+		return reply
+	}
+	reply.Result = result
+	return reply
+}
+
+// entryContent returns the content of a call of the batch. The call has
+// no binary data, and its response is kept for the reply.
+func (content *Content) entryContent(entry *batchEntry) *Content {
+	entryContent := CreateContent(nil)
+	entryContent.sockReader = bytes.NewReader(nil)
+	entryContent.sockWriter = io.Discard
+	entryContent.remoteHost = content.remoteHost
+	entryContent.strict = content.strict
+	entryContent.codec = content.codec
+	entryContent.inBatch = true
+
+	entryContent.reqHeader.setCodecId(content.codec.Id())
+	entryContent.reqBlock.Method = entry.Method
+	entryContent.reqBlock.Auth = content.reqBlock.Auth
+	entryContent.reqBlock.Meta = Metadata(nil).merge(content.reqBlock.Meta).merge(entry.Meta)
+	entryContent.reqParams = entry.Params
+	entryContent.ctx, entryContent.cancel = context.WithCancel(content.Context())
+	return entryContent
+}
+
+// encodeValue encodes a block field with the codec.
+func encodeValue(codec Codec, value any) (rawValue, error) {
+	if codec.Id() == gobCodecId {
+		return gobValue(value)
+	}
+	return codec.Marshal(value)
+}
+
+// decodeValue decodes a block field encoded by encodeValue into value.
+func decodeValue(codec Codec, data rawValue, value any) error {
+	if codec.Id() == gobCodecId {
+		return gobBind(data, value)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return codec.Unmarshal(data, value)
+}
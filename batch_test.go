@@ -0,0 +1,160 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	sleepMethod  string = "sleep"
+	secretMethod string = "secret"
+)
+
+type SleepParams struct {
+	Millis int `json:"millis" validate:"min=1"`
+}
+
+func sleepHandler(content *Content) error {
+	var err error
+	params := &SleepParams{}
+	err = content.BindParams(params)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-time.After(time.Duration(params.Millis) * time.Millisecond):
+	case <-content.Context().Done():
+		return content.Context().Err()
+	}
+	return content.SendResult(&HelloResult{Message: "slept"}, 0)
+}
+
+func TestBatch(t *testing.T) {
+	var entries atomic.Int32
+	serv := NewService()
+	serv.Handler(HelloMethod, helloHandler)
+	serv.Handler(sleepMethod, sleepHandler)
+	serv.Handler(secretMethod, helloHandler)
+	typedHello.Handler(serv, typedHelloHandler)
+	// The middleware runs for each call of a batch.
+	serv.PreMiddleware(func(content *Content) error {
+		entries.Add(1)
+		if content.Method() == secretMethod && string(content.AuthIdent()) != "admin" {
+			return errors.New("access denied")
+		}
+		return nil
+	})
+	serv.PostMiddleware(LogAccess)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	auth := CreateAuth([]byte("qwert"), []byte("12345"))
+
+	for _, opt := range []CallOption{WithCodec(JsonCodec), WithCodec(MsgpackCodec), WithCodec(GobCodec)} {
+		entries.Store(0)
+		batch := NewBatch(false)
+		hello := &HelloResult{}
+		batch.Add(HelloMethod, &HelloParams{Message: "hello"}, hello)
+		slept := &HelloResult{}
+		batch.Add(sleepMethod, &SleepParams{Millis: 1}, slept)
+		invalid := batch.Add(sleepMethod, &SleepParams{}, nil)
+		secret := batch.Add(secretMethod, &HelloParams{}, &HelloResult{})
+		unknown := batch.Add("unknown", nil, nil)
+
+		err := ExecBatch(ctx, address, batch, auth, opt)
+		require.NoError(t, err)
+		require.Equal(t, int32(5), entries.Load())
+		require.NoError(t, batch.Calls[0].Err)
+		require.Equal(t, "hello, client!", hello.Message)
+		require.NoError(t, batch.Calls[1].Err)
+		require.Equal(t, "slept", slept.Message)
+		var verr *ValidationError
+		require.ErrorAs(t, invalid.Err, &verr)
+		require.Equal(t, "millis", verr.Fields[0].Field)
+		require.EqualError(t, secret.Err, "access denied")
+		require.EqualError(t, unknown.Err, "method not found")
+		require.Equal(t, invalid.Err, batch.Err())
+	}
+
+	// The calls of a parallel batch run at the same time.
+	batch := NewBatch(true)
+	for i := 0; i < 10; i++ {
+		batch.Add(sleepMethod, &SleepParams{Millis: 200}, &HelloResult{})
+	}
+	start := time.Now()
+	err := ExecBatch(ctx, address, batch, nil)
+	require.NoError(t, err)
+	require.NoError(t, batch.Err())
+	require.Less(t, time.Since(start), time.Second)
+
+	// The deadline of the batch applies to each call.
+	batch = NewBatch(true)
+	batch.Add(sleepMethod, &SleepParams{Millis: 2000}, nil)
+	shortCtx, shortCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer shortCancel()
+	start = time.Now()
+	err = ExecBatch(shortCtx, address, batch, nil)
+	if err == nil {
+		require.Error(t, batch.Err())
+	}
+	require.Less(t, time.Since(start), time.Second)
+
+	// Typed calls of a batch.
+	batch = NewBatch(false)
+	first, _ := typedHello.AddTo(batch, &HelloParams{Message: "first"})
+	_, failed := typedHello.AddTo(batch, &HelloParams{})
+	err = ExecBatch(ctx, address, batch, nil, WithCompression(GzipCompressor))
+	require.NoError(t, err)
+	require.Equal(t, "re: first", first.Message)
+	require.EqualError(t, failed.Err, "empty message")
+
+	require.NoError(t, ExecBatch(ctx, address, NewBatch(false), nil))
+}
+
+func TestBatchLimits(t *testing.T) {
+	var running, peak atomic.Int32
+	serv := NewService()
+	serv.Handler(sleepMethod, sleepHandler)
+	serv.PreMiddleware(func(content *Content) error {
+		count := running.Add(1)
+		for {
+			max := peak.Load()
+			if count <= max || peak.CompareAndSwap(max, count) {
+				break
+			}
+		}
+		return nil
+	})
+	serv.PostMiddleware(func(content *Content) error {
+		running.Add(-1)
+		return nil
+	})
+	serv.SetBatchLimits(8, 2)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	batch := NewBatch(true)
+	for i := 0; i < 8; i++ {
+		batch.Add(sleepMethod, &SleepParams{Millis: 20}, &HelloResult{})
+	}
+	err := ExecBatch(ctx, address, batch, nil)
+	require.NoError(t, err)
+	require.NoError(t, batch.Err())
+	require.Equal(t, int32(2), peak.Load())
+
+	batch.Add(sleepMethod, &SleepParams{Millis: 1}, nil)
+	err = ExecBatch(ctx, address, batch, nil)
+	require.EqualError(t, err, "batch exceeds 8 calls")
+}
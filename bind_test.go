@@ -0,0 +1,109 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type largeParams struct {
+	Items []largeItem `json:"items"`
+}
+
+type largeItem struct {
+	Key   string   `json:"key"`
+	Value float64  `json:"value"`
+	Tags  []string `json:"tags"`
+}
+
+func largeRequest(codec Codec) []byte {
+	params := &largeParams{}
+	for i := 0; i < 10000; i++ {
+		item := largeItem{
+			Key:   fmt.Sprintf("key-%d", i),
+			Value: float64(i) / 3,
+			Tags:  []string{"a", "b", "c"},
+		}
+		params.Items = append(params.Items, item)
+	}
+	req := NewEmptyRequest()
+	req.Method = "bulk"
+	req.Params = params
+	payload, _ := codec.Marshal(req)
+	return payload
+}
+
+func bindContent(codec Codec, payload []byte) *Content {
+	conn, _ := NewFConn()
+	content := CreateContent(conn)
+	content.codec = codec
+	content.reqPacket.rcpPayload = payload
+	return content
+}
+
+func TestBindParamsOnce(t *testing.T) {
+	for _, codec := range []Codec{JsonCodec, GobCodec, MsgpackCodec} {
+		content := bindContent(codec, largeRequest(codec))
+		err := content.BindMethod()
+		require.NoError(t, err, codec.Name())
+		require.Equal(t, "bulk", content.Method(), codec.Name())
+
+		params := &largeParams{}
+		err = content.BindParams(params)
+		require.NoError(t, err, codec.Name())
+		require.Len(t, params.Items, 10000, codec.Name())
+		require.Equal(t, "key-9999", params.Items[9999].Key, codec.Name())
+	}
+}
+
+// BenchmarkBindLargeParams binds large params kept encoded by BindMethod,
+// and, for comparison, decodes the whole block twice as the binding did
+// before. MessagePack skips the kept params without decoding them, so it
+// binds them faster. encoding/json scans and copies the params to keep
+// them, so JSON gains nothing.
+func BenchmarkBindLargeParams(b *testing.B) {
+	for _, codec := range []Codec{JsonCodec, MsgpackCodec} {
+		codec := codec
+		payload := largeRequest(codec)
+		b.Run(codec.Name()+"/kept", func(b *testing.B) {
+			b.SetBytes(int64(len(payload)))
+			for i := 0; i < b.N; i++ {
+				content := bindContent(codec, payload)
+				content.BindMethod()
+				content.BindParams(&largeParams{})
+			}
+		})
+		b.Run(codec.Name()+"/twice", func(b *testing.B) {
+			b.SetBytes(int64(len(payload)))
+			for i := 0; i < b.N; i++ {
+				req := NewEmptyRequest()
+				codec.Unmarshal(payload, req)
+				req.Params = &largeParams{}
+				codec.Unmarshal(payload, req)
+			}
+		})
+	}
+}
+
+func TestBindJsonParamsKey(t *testing.T) {
+	blocks := []string{
+		`{"method":"hello","Params":{"message":"hi"}}`,
+		`{"method":"hello","\u0070arams":{"message":"hi"}}`,
+		`{"method":"hello","params":{"message":"no"},"params":{"message":"hi"}}`,
+	}
+	for _, block := range blocks {
+		content := bindContent(JsonCodec, []byte(block))
+		require.NoError(t, content.BindMethod(), block)
+		require.Equal(t, "hello", content.Method(), block)
+		params := &HelloParams{}
+		require.NoError(t, content.BindParams(params), block)
+		require.Equal(t, "hi", params.Message, block)
+	}
+	content := bindContent(JsonCodec, []byte(`{"method":"hello","params":{"message":"hi"}`))
+	require.Error(t, content.BindMethod())
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNoCallbacks is returned by Call if the client of the request does
+// not answer callbacks.
+var ErrNoCallbacks = errors.New("client has no callbacks")
+
+// WithCallbacks lets the server of the call invoke the methods of svc on
+// the client before it sends the response. The handlers run with the
+// middleware of svc, one at a time, while the call waits for the response.
+func WithCallbacks(svc *Service) CallOption {
+	return func(content *Content) {
+		content.callbacks = svc
+		content.reqHeader.setFlag(flagCallback)
+	}
+}
+
+// Call invokes the method on the client of the request and decodes the
+// result. The callback carries the auth of the request and is made before
+// the response is sent, once the binary data of the request is read.
+func (content *Content) Call(ctx context.Context, method string, param, result any, opts ...CallOption) error {
+	var err error
+	content.callMutex.Lock()
+	defer content.callMutex.Unlock()
+
+	if !content.reqHeader.hasFlag(flagCallback) {
+		return ErrNoCallbacks
+	}
+	if content.reqHeader.hasFlag(flagStream) {
+		err = errors.New("callback in message stream")
+		return err
+	}
+	if content.resSent {
+		err = errors.New("response already sent")
+		return err
+	}
+	if content.watch && content.reqHeader.binSize != 0 {
+		err = errors.New("binary data is not read")
+		return err
+	}
+	content.watchConn()
+
+	call := CreateContent(nil)
+	call.codec = content.codec
+	call.blockMax = content.blockMax
+	call.applyOptions(opts)
+	call.reqBlock.Method = method
+	call.reqBlock.Auth = content.reqBlock.Auth
+	if param != nil {
+		call.reqBlock.Params = param
+	}
+	if result != nil {
+		call.resBlock.Result = result
+	}
+	call.reqHeader.setFrameKind(frameCallback)
+	err = call.createRequest(ctx)
+	if err != nil {
+		return err
+	}
+	// A reply left by an abandoned callback is dropped.
+	select {
+	case <-content.replies:
+	default:
+	}
+	_, err = content.sockWriter.Write(append(call.reqPacket.header, call.reqPacket.rcpPayload...))
+	if err != nil {
+		return err
+	}
+
+	var reply *Packet
+	select {
+	case reply = <-content.replies:
+	case <-ctx.Done():
+		return contextError(ctx, ctx.Err())
+	case <-content.Context().Done():
+		err = fmt.Errorf("break by context: %w", content.Context().Err())
+		return err
+	}
+	call.resPacket = reply
+	call.resHeader, err = UnpackHeader(reply.header)
+	if err != nil {
+		return err
+	}
+	err = call.unzipResponse()
+	if err != nil {
+		return err
+	}
+	return call.bindResponse()
+}
+
+// passReply reads the payload of a reply frame and passes the reply to
+// the pending callback.
+func (content *Content) passReply(headerBytes []byte, header *Header) error {
+	var err error
+	payload, err := readBlock(content.sockReader, header.rpcSize, content.blockMax)
+	if err != nil {
+		return err
+	}
+	if content.replies == nil {
+		err = errors.New("unexpected reply")
+		return err
+	}
+	reply := &Packet{
+		header:     headerBytes,
+		rcpPayload: payload,
+	}
+	select {
+	case content.replies <- reply:
+	case <-content.Context().Done():
+	}
+	return err
+}
+
+// answerCallback runs the callback of the server on the client and
+// writes the reply.
+func (content *Content) answerCallback(header *Header, payload []byte) error {
+	var err error
+	if content.callbacks == nil {
+		err = errors.New("unexpected callback")
+		return err
+	}
+	reply, err := content.callbacks.serveCallback(content.Context(), header, payload)
+	if err != nil {
+		return err
+	}
+	_, err = content.sockWriter.Write(reply)
+	return err
+}
+
+// serveCallback runs the handler of a callback and returns the reply
+// frame.
+func (svc *Service) serveCallback(ctx context.Context, header *Header, payload []byte) ([]byte, error) {
+	var err error
+	header.setFrameKind(frameCall)
+	headerBytes, err := header.Pack()
+	if err != nil {
+		return nil, err
+	}
+	buffer := bytes.NewBuffer(nil)
+	content := CreateContent(nil)
+	content.sockReader = io.MultiReader(bytes.NewReader(headerBytes), bytes.NewReader(payload))
+	content.sockWriter = buffer
+	content.strict = svc.strict
+	content.zipMin = svc.zipMin
+	content.blockMax = svc.blockMax
+	content.inCallback = true
+	defer content.closeContext()
+
+	err = svc.readCallback(ctx, content)
+	if err != nil {
+		content.SendError(err)
+	} else {
+		svc.serve(content)
+	}
+	if !content.resSent {
+		content.SendError(errors.New("callback is not answered"))
+	}
+
+	reply := buffer.Bytes()
+	replyHeader, err := UnpackHeader(reply[:headerSize])
+	if err != nil {
+		return nil, err
+	}
+	replyHeader.setFrameKind(frameReply)
+	headerBytes, err = replyHeader.Pack()
+	if err != nil {
+		return nil, err
+	}
+	copy(reply, headerBytes)
+	return reply, err
+}
+
+// readCallback reads the request of a callback.
+func (svc *Service) readCallback(ctx context.Context, content *Content) error {
+	var err error
+	err = content.ReadRequest()
+	if err != nil {
+		return err
+	}
+	if content.reqHeader.hasFlag(flagStream|flagNotify|flagBatch|flagCallback) || content.reqHeader.binSize != 0 {
+		err = errors.New("wrong callback request")
+		return err
+	}
+	err = content.BindMethod()
+	if err != nil {
+		return err
+	}
+	err = content.setContext(ctx)
+	if err != nil {
+		return err
+	}
+	content.acceptCompression()
+	return err
+}
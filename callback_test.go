@@ -0,0 +1,149 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	deleteMethod  string = "delete"
+	confirmMethod string = "confirm"
+	uploadMethod  string = "upload"
+)
+
+// deleteHandler asks the client to confirm each of the files.
+func deleteHandler(content *Content) error {
+	var err error
+	params := &ListParams{}
+	err = content.BindParams(params)
+	if err != nil {
+		return err
+	}
+	deleted := 0
+	for i := 0; i < params.Count; i++ {
+		answer := &HelloResult{}
+		err = content.Call(content.Context(), confirmMethod, &HelloParams{Message: "file"}, answer)
+		if err != nil {
+			return err
+		}
+		if answer.Message == "yes" {
+			deleted++
+		}
+	}
+	if len(params.Fail) > 0 {
+		err = content.Call(content.Context(), params.Fail, nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return content.SendResult(&HelloResult{Message: strconv.Itoa(deleted)}, 0)
+}
+
+// uploadHandler confirms the upload after the data is read.
+func uploadHandler(content *Content) error {
+	var err error
+	err = content.Call(content.Context(), confirmMethod, &HelloParams{}, nil)
+	if err == nil {
+		return errors.New("callback before the data is read")
+	}
+	buffer := bytes.NewBuffer(nil)
+	err = content.ReadBin(content.Context(), buffer)
+	if err != nil {
+		return err
+	}
+	answer := &HelloResult{}
+	err = content.Call(content.Context(), confirmMethod, &HelloParams{Message: buffer.String()}, answer)
+	if err != nil {
+		return err
+	}
+	return content.SendResult(answer, 0)
+}
+
+func TestCallback(t *testing.T) {
+	serv := NewService()
+	serv.Handler(deleteMethod, deleteHandler)
+	serv.Handler(uploadMethod, uploadHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	auth := CreateAuth([]byte("qwert"), []byte("12345"))
+
+	asked := 0
+	callbacks := NewService()
+	callbacks.PreMiddleware(func(content *Content) error {
+		// The callback carries the auth of the call.
+		if string(content.AuthIdent()) != "qwert" {
+			return errors.New("access denied")
+		}
+		return nil
+	})
+	callbacks.Handler(confirmMethod, func(content *Content) error {
+		params := &HelloParams{}
+		err := content.BindParams(params)
+		if err != nil {
+			return err
+		}
+		asked++
+		answer := "yes"
+		if asked%2 == 0 {
+			answer = "no"
+		}
+		if params.Message == "big data" {
+			answer = "stored"
+		}
+		return content.SendResult(&HelloResult{Message: answer}, 0)
+	})
+
+	for _, opt := range []CallOption{WithCodec(JsonCodec), WithCodec(MsgpackCodec), WithCompression(FlateCompressor)} {
+		asked = 0
+		result := &HelloResult{}
+		err := Exec(ctx, address, deleteMethod, &ListParams{Count: 4}, result, auth,
+			WithCallbacks(callbacks), opt)
+		require.NoError(t, err)
+		require.Equal(t, 4, asked)
+		require.Equal(t, "2", result.Message)
+	}
+
+	// The error of a callback is returned to the server handler.
+	result := &HelloResult{}
+	err := Exec(ctx, address, deleteMethod, &ListParams{Count: 1, Fail: "unknown"}, result, auth,
+		WithCallbacks(callbacks))
+	require.EqualError(t, err, "method not found")
+
+	err = Exec(ctx, address, deleteMethod, &ListParams{Count: 1}, result, nil,
+		WithCallbacks(callbacks))
+	require.EqualError(t, err, "access denied")
+
+	err = Exec(ctx, address, deleteMethod, &ListParams{Count: 1}, result, auth)
+	require.EqualError(t, err, ErrNoCallbacks.Error())
+
+	// The server calls back once the binary data is read.
+	data := []byte("big data")
+	err = Put(ctx, address, uploadMethod, bytes.NewReader(data), int64(len(data)), nil, result, auth,
+		WithCallbacks(callbacks))
+	require.NoError(t, err)
+	require.Equal(t, "stored", result.Message)
+
+	// A blocked callback is broken by the deadline of the call.
+	slow := NewService()
+	slow.Handler(confirmMethod, func(content *Content) error {
+		<-content.Context().Done()
+		return content.Context().Err()
+	})
+	shortCtx, shortCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer shortCancel()
+	err = Exec(shortCtx, address, deleteMethod, &ListParams{Count: 1}, result, auth,
+		WithCallbacks(slow))
+	require.Error(t, err)
+}
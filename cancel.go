@@ -0,0 +1,131 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// cancelGrace is the time the client waits for the server to stop a
+// canceled call before it drops the connection.
+const cancelGrace = time.Second
+
+type canceledError struct{}
+
+func (canceledError) Error() string {
+	return "call canceled"
+}
+
+func (canceledError) Is(target error) bool {
+	return target == context.Canceled
+}
+
+// ErrCanceled is returned by a call canceled by its context. It matches
+// context.Canceled with errors.Is.
+var ErrCanceled error = canceledError{}
+
+// contextError returns the error of ctx for a call broken by ctx. The
+// server drops the connection at the same deadline, so a call broken
+// after the deadline is broken by it, even if ctx is not done yet.
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return err
+	}
+	if ctx.Err() == nil {
+		deadline, ok := ctx.Deadline()
+		if ok && !time.Now().Before(deadline) {
+			return context.DeadlineExceeded
+		}
+		return err
+	}
+	if ctx.Err() == context.Canceled {
+		return ErrCanceled
+	}
+	return ctx.Err()
+}
+
+// watchContext stops the call when ctx is done. Once the request input
+// is written, a cancel frame is sent and the server gets some time to
+// answer, otherwise the blocking io of the connection is broken at once.
+// The returned function stops the watching.
+func (content *Content) watchContext(ctx context.Context, conn net.Conn) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		if !content.inputDone.Load() {
+			conn.SetDeadline(time.Now())
+			return
+		}
+		conn.SetWriteDeadline(time.Now().Add(cancelGrace))
+		err := content.sendCancel()
+		if err != nil {
+			conn.SetDeadline(time.Now())
+			return
+		}
+		timer := time.NewTimer(cancelGrace)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+func (content *Content) sendCancel() error {
+	var err error
+	header := NewEmptyHeader()
+	header.setFrameKind(frameCancel)
+	headerBytes, err := header.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = content.sockWriter.Write(headerBytes)
+	return err
+}
+
+// watchConn reads the control frames which follow the request and
+// cancels the request context on a cancel frame or when the client
+// disconnects. Reply frames are passed to the pending callback. It must
+// be started when the request input is consumed.
+func (content *Content) watchConn() {
+	if !content.watch || content.cancel == nil {
+		return
+	}
+	content.watch = false
+	go func() {
+		for {
+			headerBytes, err := ReadBytes(content.sockReader, headerSize)
+			if err != nil {
+				content.cancel()
+				return
+			}
+			header, err := UnpackHeader(headerBytes)
+			if err != nil {
+				content.cancel()
+				return
+			}
+			switch header.frameKind() {
+			case frameCancel:
+				content.cancel()
+			case frameReply:
+				err = content.passReply(headerBytes, header)
+				if err != nil {
+					content.cancel()
+					return
+				}
+			}
+		}
+	}()
+}
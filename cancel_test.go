@@ -0,0 +1,87 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const streamMethod string = "stream"
+
+// slowReader produces data until ctx is done.
+type slowReader struct {
+	ctx context.Context
+}
+
+func (reader slowReader) Read(buffer []byte) (int, error) {
+	select {
+	case <-reader.ctx.Done():
+		return 0, reader.ctx.Err()
+	case <-time.After(10 * time.Millisecond):
+	}
+	return len(buffer), nil
+}
+
+func TestCancelFrame(t *testing.T) {
+	done := make(chan error, 2)
+	serv := NewService()
+	serv.Handler(waitMethod, func(content *Content) error {
+		<-content.Context().Done()
+		done <- content.Context().Err()
+		return content.Context().Err()
+	})
+	serv.Handler(streamMethod, func(content *Content) error {
+		var err error
+		err = content.SendResult(NewEmptyResult(), 1<<30)
+		if err != nil {
+			return err
+		}
+		reader := slowReader{ctx: content.Context()}
+		_, err = CopyBytes(context.Background(), reader, content.BinWriter(), 1<<30)
+		done <- content.Context().Err()
+		return err
+	})
+	address := startService(t, serv)
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	err = ConnExec(ctx, conn, waitMethod, nil, nil, nil)
+	require.ErrorIs(t, err, ErrCanceled)
+	require.True(t, errors.Is(err, context.Canceled))
+	require.ErrorIs(t, <-done, context.Canceled)
+	// The server answered the cancel frame before the grace period.
+	require.Less(t, time.Since(start), cancelGrace)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	err = Get(ctx, address, streamMethod, io.Discard, nil, nil, nil)
+	require.ErrorIs(t, err, ErrCanceled)
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestCancelHeader(t *testing.T) {
+	header := NewEmptyHeader()
+	header.setCodecId(MsgpackCodec.Id())
+	header.setFrameKind(frameCancel)
+	headerBytes, err := header.Pack()
+	require.NoError(t, err)
+
+	unpacked, err := UnpackHeader(headerBytes)
+	require.NoError(t, err)
+	require.Equal(t, frameCancel, unpacked.frameKind())
+	require.Equal(t, MsgpackCodec.Id(), unpacked.codecId())
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"errors"
+	"io"
+)
+
+// ChunkedSize is the binary size of a stream of unknown length. The data
+// is sent in chunks, each one prefixed by its size, and an empty chunk
+// ends the stream.
+const ChunkedSize int64 = -1
+
+type chunkWriter struct {
+	writer io.Writer
+	wire   *int64
+	closed bool
+}
+
+func newChunkWriter(writer io.Writer) *chunkWriter {
+	return &chunkWriter{writer: writer}
+}
+
+func (chunks *chunkWriter) Write(data []byte) (int, error) {
+	var err error
+	if chunks.closed {
+		err = errors.New("write to closed stream")
+		return 0, err
+	}
+	if len(data) == 0 {
+		return 0, err
+	}
+	_, err = chunks.writer.Write(EncoderI64(int64(len(data))))
+	if err != nil {
+		return 0, err
+	}
+	written, err := chunks.writer.Write(data)
+	chunks.count(int64(sizeOfInt64 + written))
+	return written, err
+}
+
+// Close writes the end of the stream.
+func (chunks *chunkWriter) Close() error {
+	var err error
+	if chunks.closed {
+		return err
+	}
+	chunks.closed = true
+	_, err = chunks.writer.Write(EncoderI64(0))
+	chunks.count(int64(sizeOfInt64))
+	return err
+}
+
+func (chunks *chunkWriter) count(size int64) {
+	if chunks.wire != nil {
+		*chunks.wire += size
+	}
+}
+
+type chunkReader struct {
+	reader  io.Reader
+	wire    *int64
+	remains int64
+	eof     bool
+}
+
+func newChunkReader(reader io.Reader) *chunkReader {
+	return &chunkReader{reader: reader}
+}
+
+func (chunks *chunkReader) Read(buffer []byte) (int, error) {
+	var err error
+	if chunks.eof {
+		return 0, io.EOF
+	}
+	if chunks.remains == 0 {
+		sizeBytes, err := ReadBytes(chunks.reader, int64(sizeOfInt64))
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		chunks.count(int64(sizeOfInt64))
+		chunks.remains = DecoderI64(sizeBytes)
+		if chunks.remains < 0 {
+			err = errors.New("wrong chunk size")
+			return 0, err
+		}
+		if chunks.remains == 0 {
+			chunks.eof = true
+			return 0, io.EOF
+		}
+	}
+	if int64(len(buffer)) > chunks.remains {
+		buffer = buffer[0:chunks.remains]
+	}
+	read, err := chunks.reader.Read(buffer)
+	chunks.remains -= int64(read)
+	chunks.count(int64(read))
+	if err == io.EOF {
+		// The stream ends with an empty chunk only.
+		err = io.ErrUnexpectedEOF
+		if chunks.remains == 0 {
+			err = nil
+		}
+	}
+	return read, err
+}
+
+func (chunks *chunkReader) count(size int64) {
+	if chunks.wire != nil {
+		*chunks.wire += size
+	}
+}
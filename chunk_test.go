@@ -0,0 +1,110 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	saveStreamMethod string = "saveStream"
+	dumpStreamMethod string = "dumpStream"
+)
+
+type streamResult struct {
+	Size int64 `json:"size"`
+}
+
+func saveStreamHandler(content *Content) error {
+	var err error
+	buffer := bytes.NewBuffer(nil)
+	err = content.ReadBin(content.Context(), buffer)
+	if err != nil {
+		return err
+	}
+	if content.BinSize() != ChunkedSize {
+		return content.SendError(io.ErrUnexpectedEOF)
+	}
+	return content.SendResult(&streamResult{Size: int64(buffer.Len())}, 0)
+}
+
+func dumpStreamHandler(content *Content) error {
+	var err error
+	writer, err := content.SendResultChunked(&streamResult{Size: -1})
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 3; i++ {
+		_, err = writer.Write(bytes.Repeat([]byte{byte('a' + i)}, 10000))
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+func TestChunkedTransfer(t *testing.T) {
+	serv := NewService()
+	serv.Handler(saveStreamMethod, saveStreamHandler)
+	serv.Handler(dumpStreamMethod, dumpStreamHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The reader does not tell its size.
+	data := make([]byte, 100000)
+	rand.Read(data)
+	reader := io.LimitReader(rand.Reader, 100000)
+	result := &streamResult{}
+	err := PutStream(ctx, address, saveStreamMethod, reader, nil, result, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(100000), result.Size)
+
+	writer := bytes.NewBuffer(nil)
+	err = Get(ctx, address, dumpStreamMethod, writer, nil, result, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(-1), result.Size)
+	require.Equal(t, 30000, writer.Len())
+	require.Equal(t, byte('c'), writer.Bytes()[29999])
+
+	err = LocalPut(ctx, saveStreamMethod, bytes.NewReader(data), ChunkedSize, nil, result, nil, saveStreamHandler)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), result.Size)
+
+	writer.Reset()
+	err = LocalGet(ctx, dumpStreamMethod, writer, nil, result, nil, dumpStreamHandler)
+	require.NoError(t, err)
+	require.Equal(t, 30000, writer.Len())
+}
+
+func TestChunkReader(t *testing.T) {
+	stream := bytes.NewBuffer(nil)
+	writer := newChunkWriter(stream)
+	writer.Write([]byte("hello, "))
+	writer.Write(nil)
+	writer.Write([]byte("world"))
+	require.NoError(t, writer.Close())
+	_, err := writer.Write([]byte("late"))
+	require.Error(t, err)
+
+	encoded := stream.Bytes()
+	data, err := io.ReadAll(newChunkReader(bytes.NewReader(encoded)))
+	require.NoError(t, err)
+	require.Equal(t, "hello, world", string(data))
+
+	// A stream without the end chunk is truncated.
+	_, err = io.ReadAll(newChunkReader(bytes.NewReader(encoded[:len(encoded)-8])))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = io.ReadAll(newChunkReader(bytes.NewReader(encoded[:10])))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -11,30 +11,25 @@ import (
 	"io"
 	"net"
 	"sync"
-
-	encoder "encoding/json"
+	"time"
 )
 
-func Put(ctx context.Context, address string, method string, reader io.Reader, binSize int64, param, result any, auth *Auth) error {
+func Put(ctx context.Context, address string, method string, reader io.Reader, binSize int64, param, result any, auth *Auth, opts ...CallOption) error {
 	var err error
 
-	addr, err := net.ResolveTCPAddr("tcp", address)
-	if err != nil {
-		err = fmt.Errorf("unable to resolve adddress: %s", err)
-		return err
-	}
-	conn, err := net.DialTCP("tcp", nil, addr)
+	conn, err := dial(ctx, address)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	return ConnPut(ctx, conn, method, reader, binSize, param, result, auth)
+	return ConnPut(ctx, conn, method, reader, binSize, param, result, auth, opts...)
 }
 
-func ConnPut(ctx context.Context, conn net.Conn, method string, reader io.Reader, binSize int64, param, result any, auth *Auth) error {
+func ConnPut(ctx context.Context, conn net.Conn, method string, reader io.Reader, binSize int64, param, result any, auth *Auth, opts ...CallOption) error {
 	var err error
 	content := CreateContent(conn)
+	content.applyOptions(opts)
 
 	content.reqBlock.Method = method
 	if param != nil {
@@ -48,61 +43,79 @@ func ConnPut(ctx context.Context, conn net.Conn, method string, reader io.Reader
 	}
 
 	content.binReader = reader
-	content.binWriter = conn
 
 	content.reqHeader.binSize = binSize
 
-	err = content.createRequest()
+	err = content.createRequest(ctx)
 	if err != nil {
 		return err
 	}
+	stop := content.watchContext(ctx, conn)
+	defer stop()
+
 	err = content.writeRequest()
 	if err != nil {
-		return err
+		return contextError(ctx, err)
 	}
 
 	var wg sync.WaitGroup
 	errChan := make(chan error, 1)
+	upErrChan := make(chan error, 1)
 
 	wg.Add(1)
 	go content.readResponseAsync(&wg, errChan)
 
 	wg.Add(1)
-	go content.uploadBinAsync(ctx, &wg)
+	go content.uploadBinAsync(ctx, conn, &wg, upErrChan)
 
 	wg.Wait()
+	err = <-upErrChan
+	if err != nil {
+		return contextError(ctx, err)
+	}
 	err = <-errChan
 	if err != nil {
-		return err
+		return contextError(ctx, err)
 	}
 	err = content.bindResponse()
 	if err != nil {
-		return err
+		return contextError(ctx, err)
+	}
+	err = content.readTrailer()
+	if err != nil {
+		return contextError(ctx, err)
 	}
 	return err
 }
 
-func Get(ctx context.Context, address string, method string, writer io.Writer, param, result any, auth *Auth) error {
+// PutStream uploads the data of reader up to its end in chunks, the size
+// of the data is not needed.
+func PutStream(ctx context.Context, address string, method string, reader io.Reader, param, result any, auth *Auth, opts ...CallOption) error {
+	return Put(ctx, address, method, reader, ChunkedSize, param, result, auth, opts...)
+}
+
+// ConnPutStream is PutStream over an established connection.
+func ConnPutStream(ctx context.Context, conn net.Conn, method string, reader io.Reader, param, result any, auth *Auth, opts ...CallOption) error {
+	return ConnPut(ctx, conn, method, reader, ChunkedSize, param, result, auth, opts...)
+}
+
+func Get(ctx context.Context, address string, method string, writer io.Writer, param, result any, auth *Auth, opts ...CallOption) error {
 	var err error
 
-	addr, err := net.ResolveTCPAddr("tcp", address)
-	if err != nil {
-		err = fmt.Errorf("unable to resolve adddress: %s", err)
-		return err
-	}
-	conn, err := net.DialTCP("tcp", nil, addr)
+	conn, err := dial(ctx, address)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	return ConnGet(ctx, conn, method, writer, param, result, auth)
+	return ConnGet(ctx, conn, method, writer, param, result, auth, opts...)
 }
 
-func ConnGet(ctx context.Context, conn net.Conn, method string, writer io.Writer, param, result any, auth *Auth) error {
+func ConnGet(ctx context.Context, conn net.Conn, method string, writer io.Writer, param, result any, auth *Auth, opts ...CallOption) error {
 	var err error
 
 	content := CreateContent(conn)
+	content.applyOptions(opts)
 	content.reqBlock.Method = method
 	if param != nil {
 		content.reqBlock.Params = param
@@ -114,57 +127,62 @@ func ConnGet(ctx context.Context, conn net.Conn, method string, writer io.Writer
 		content.resBlock.Result = result
 	}
 
-	content.binReader = conn
 	content.binWriter = writer
 
-	err = content.createRequest()
+	err = content.createRequest(ctx)
 	if err != nil {
 		return err
 	}
+	stop := content.watchContext(ctx, conn)
+	defer stop()
+
 	err = content.writeRequest()
 	if err != nil {
-		return err
+		return contextError(ctx, err)
 	}
+	content.inputDone.Store(true)
+
 	err = content.readResponse()
 	if err != nil {
-		return err
+		return contextError(ctx, err)
+	}
+	// The result tells the range of the data, so it is bound first.
+	err = content.bindResponse()
+	if err != nil {
+		return contextError(ctx, err)
 	}
 	err = content.downloadBin(ctx)
 	if err != nil {
-		return err
+		return contextError(ctx, err)
 	}
-	err = content.bindResponse()
+	err = content.readTrailer()
 	if err != nil {
-		return err
+		return contextError(ctx, err)
 	}
 	return err
 }
 
-func Exec(ctx context.Context, address, method string, param any, result any, auth *Auth) error {
+func Exec(ctx context.Context, address, method string, param any, result any, auth *Auth, opts ...CallOption) error {
 	var err error
 
-	addr, err := net.ResolveTCPAddr("tcp", address)
-	if err != nil {
-		err = fmt.Errorf("unable to resolve adddress: %s", err)
-		return err
-	}
-	conn, err := net.DialTCP("tcp", nil, addr)
+	conn, err := dial(ctx, address)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	err = ConnExec(ctx, conn, method, param, result, auth)
+	err = ConnExec(ctx, conn, method, param, result, auth, opts...)
 	if err != nil {
 		return err
 	}
 	return err
 }
 
-func ConnExec(ctx context.Context, conn net.Conn, method string, param any, result any, auth *Auth) error {
+func ConnExec(ctx context.Context, conn net.Conn, method string, param any, result any, auth *Auth, opts ...CallOption) error {
 	var err error
 
 	content := CreateContent(conn)
+	content.applyOptions(opts)
 	content.reqBlock.Method = method
 
 	if param != nil {
@@ -177,29 +195,61 @@ func ConnExec(ctx context.Context, conn net.Conn, method string, param any, resu
 		content.reqBlock.Auth = auth
 	}
 
-	err = content.createRequest()
+	err = content.createRequest(ctx)
 	if err != nil {
 		return err
 	}
+	stop := content.watchContext(ctx, conn)
+	defer stop()
+
 	err = content.writeRequest()
 	if err != nil {
-		return err
+		return contextError(ctx, err)
 	}
+	content.inputDone.Store(true)
+
 	err = content.readResponse()
 	if err != nil {
-		return err
+		return contextError(ctx, err)
 	}
 	err = content.bindResponse()
 	if err != nil {
-		return err
+		return contextError(ctx, err)
+	}
+	err = content.readTrailer()
+	if err != nil {
+		return contextError(ctx, err)
 	}
 	return err
 }
 
-func (content *Content) createRequest() error {
+func (content *Content) createRequest(ctx context.Context) error {
 	var err error
 
-	content.reqPacket.rcpPayload, err = content.reqBlock.Pack()
+	err = checkMetadata(content.reqBlock.Meta)
+	if err != nil {
+		return err
+	}
+	err = content.setDeadline(ctx)
+	if err != nil {
+		return err
+	}
+	err = content.requestDigest()
+	if err != nil {
+		return err
+	}
+	content.requestCompression()
+	if content.callbacks != nil {
+		// The callbacks run within the call.
+		content.ctx = ctx
+	}
+	content.reqHeader.setCodecId(content.codec.Id())
+	payload, err := content.codec.Marshal(content.reqBlock)
+	if err != nil {
+		return err
+	}
+	content.reqRpcRaw = int64(len(payload))
+	content.reqPacket.rcpPayload, err = content.zipBlock(content.reqHeader, payload)
 	if err != nil {
 		return err
 	}
@@ -228,38 +278,105 @@ func (content *Content) writeRequest() error {
 
 func (content *Content) uploadBin(ctx context.Context) error {
 	var err error
-	_, err = CopyBytes(ctx, content.binReader, content.binWriter, content.reqHeader.binSize)
-	return err
-}
-
-func (content *Content) readResponse() error {
-	var err error
-
-	content.resPacket.header, err = ReadBytes(content.sockReader, headerSize)
+	reader := content.binReader
+	if content.reqHash != nil {
+		reader = io.TeeReader(reader, content.reqHash)
+	}
+	writer, err := binOutputOf(content.reqHeader, content.sockWriter, &content.reqBinWire)
 	if err != nil {
 		return err
 	}
-	content.resHeader, err = UnpackHeader(content.resPacket.header)
+	_, err = CopyBytes(ctx, reader, writer, content.reqHeader.binSize)
 	if err != nil {
 		return err
 	}
-	rpcSize := content.resHeader.rpcSize
-	content.resPacket.rcpPayload, err = ReadBytes(content.sockReader, rpcSize)
+	err = writer.Close()
 	if err != nil {
 		return err
 	}
-	return err
+	return content.writeReqTrailer()
 }
 
-func (content *Content) uploadBinAsync(ctx context.Context, wg *sync.WaitGroup) {
+func (content *Content) readResponse() error {
+	var err error
+
+	for {
+		content.resPacket.header, err = ReadBytes(content.sockReader, headerSize)
+		if err != nil {
+			return err
+		}
+		content.resHeader, err = UnpackHeader(content.resPacket.header)
+		if err != nil {
+			return err
+		}
+		rpcSize := content.resHeader.rpcSize
+		content.resPacket.rcpPayload, err = readBlock(content.sockReader, rpcSize, content.blockMax)
+		if err != nil {
+			return err
+		}
+		if content.resHeader.frameKind() != frameCallback {
+			break
+		}
+		// The server calls back before the response.
+		err = content.answerCallback(content.resHeader, content.resPacket.rcpPayload)
+		if err != nil {
+			return err
+		}
+	}
+	return content.unzipResponse()
+}
+
+// uploadBinAsync uploads the request binary data and sends the error of
+// the data source to errChan. The server waits for the rest of the data
+// of a failed source, so the connection is broken. A failed write is not
+// reported, the response of the server tells the reason.
+func (content *Content) uploadBinAsync(ctx context.Context, conn net.Conn, wg *sync.WaitGroup, errChan chan error) {
+	var err error
 	exitFunc := func() {
+		errChan <- err
 		wg.Done()
 	}
 	defer exitFunc()
-	_, _ = CopyBytes(ctx, content.binReader, content.binWriter, content.reqHeader.binSize)
+	source := &sourceReader{
+		reader:  content.binReader,
+		remains: content.reqHeader.binSize,
+	}
+	content.binReader = source
+	err = content.uploadBin(ctx)
+	if err == nil {
+		content.inputDone.Store(true)
+		return
+	}
+	if source.err == nil {
+		err = nil
+		return
+	}
+	conn.SetDeadline(time.Now())
 	return
 }
 
+// sourceReader keeps the error of the reader of the data to upload. The
+// end of the data before its size is an error.
+type sourceReader struct {
+	reader  io.Reader
+	remains int64
+	err     error
+}
+
+func (reader *sourceReader) Read(buffer []byte) (int, error) {
+	read, err := reader.reader.Read(buffer)
+	if reader.remains >= 0 {
+		reader.remains -= int64(read)
+	}
+	if err == io.EOF && reader.remains > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil && err != io.EOF {
+		reader.err = err
+	}
+	return read, err
+}
+
 func (content *Content) readResponseAsync(wg *sync.WaitGroup, errChan chan error) {
 	var err error
 	exitFunc := func() {
@@ -267,41 +384,70 @@ func (content *Content) readResponseAsync(wg *sync.WaitGroup, errChan chan error
 		wg.Done()
 	}
 	defer exitFunc()
-	content.resPacket.header, err = ReadBytes(content.sockReader, headerSize)
-	if err != nil {
-		err = err
-		return
-	}
-	content.resHeader, err = UnpackHeader(content.resPacket.header)
-	if err != nil {
-		err = err
-		return
-	}
-	rpcSize := content.resHeader.rpcSize
-	content.resPacket.rcpPayload, err = ReadBytes(content.sockReader, rpcSize)
+	err = content.readResponse()
+	return
+}
+
+func (content *Content) unzipResponse() error {
+	var err error
+	content.resPacket.rcpPayload, err = unzipBlock(content.resHeader, content.resPacket.rcpPayload, content.blockMax)
 	if err != nil {
-		err = err
-		return
+		return err
 	}
-	return
+	content.resRpcRaw = int64(len(content.resPacket.rcpPayload))
+	return err
 }
 
 func (content *Content) downloadBin(ctx context.Context) error {
 	var err error
-	_, err = CopyBytes(ctx, content.binReader, content.binWriter, content.resHeader.binSize)
+	writer := content.binWriter
+	if content.resHash != nil && writer != nil {
+		writer = &hashWriter{writer: writer, hash: content.resHash}
+	}
+	reader, err := binInputOf(content.resHeader, content.sockReader, &content.resBinWire)
+	if err != nil {
+		return err
+	}
+	_, err = CopyBytes(ctx, reader, writer, content.resHeader.binSize)
 	return err
 }
 
 func (content *Content) bindResponse() error {
 	var err error
 
-	err = encoder.Unmarshal(content.resPacket.rcpPayload, content.resBlock)
+	codec := content.codec
+	if content.resHeader.codecId() != codec.Id() {
+		codec, err = codecById(content.resHeader.codecId())
+		if err != nil {
+			return err
+		}
+	}
+	err = codec.Unmarshal(content.resPacket.rcpPayload, content.resBlock)
 	if err != nil {
 		return err
 	}
+	content.bindMetadata()
+	content.bindRange()
+	if len(content.resBlock.Fields) > 0 {
+		err = &ValidationError{Fields: content.resBlock.Fields}
+		return err
+	}
 	if len(content.resBlock.Error) > 0 {
 		err = errors.New(content.resBlock.Error)
 		return err
 	}
 	return err
 }
+
+// dial resolves the address and connects to it. The connect breaks when
+// ctx is done.
+func dial(ctx context.Context, address string) (net.Conn, error) {
+	var err error
+	addr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		err = fmt.Errorf("unable to resolve address: %s", err)
+		return nil, err
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", addr.String())
+}
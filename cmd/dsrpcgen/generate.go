@@ -0,0 +1,182 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"strconv"
+	"text/template"
+)
+
+var codeTemplate = template.Must(template.New("code").Parse(`// Code generated by dsrpcgen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"context"
+	"errors"
+	{{- if .HasBin }}
+	"io"
+	{{- end }}
+
+	"github.com/kindsoldier/dsrpc"
+	{{- range .Imports }}
+	{{ . }}
+	{{- end }}
+)
+
+{{ $svc := .Name -}}
+// Method descriptors of {{ $svc }}.
+var (
+{{- range .Methods }}
+	{{ $svc }}{{ .Name }} = dsrpc.Method[{{ .Params }}, {{ .Result }}]("{{ .RPC }}")
+{{- end }}
+)
+
+// {{ $svc }}Client calls {{ $svc }} methods on a remote service.
+type {{ $svc }}Client struct {
+	Address string
+	Auth    *dsrpc.Auth
+	Options []dsrpc.CallOption
+}
+
+func New{{ $svc }}Client(address string, auth *dsrpc.Auth) *{{ $svc }}Client {
+	return &{{ $svc }}Client{
+		Address: address,
+		Auth:    auth,
+	}
+}
+
+var _ {{ $svc }} = (*{{ $svc }}Client)(nil)
+{{ range .Methods }}
+{{- if eq .Kind "exec" }}
+func (client *{{ $svc }}Client) {{ .Name }}(ctx context.Context, params *{{ .Params }}) (*{{ .Result }}, error) {
+	return {{ $svc }}{{ .Name }}.Exec(ctx, client.Address, params, client.Auth, client.Options...)
+}
+{{- else if eq .Kind "put" }}
+func (client *{{ $svc }}Client) {{ .Name }}(ctx context.Context, reader io.Reader, size int64, params *{{ .Params }}) (*{{ .Result }}, error) {
+	return {{ $svc }}{{ .Name }}.Put(ctx, client.Address, reader, size, params, client.Auth, client.Options...)
+}
+{{- else }}
+func (client *{{ $svc }}Client) {{ .Name }}(ctx context.Context, writer io.Writer, params *{{ .Params }}) (*{{ .Result }}, error) {
+	return {{ $svc }}{{ .Name }}.Get(ctx, client.Address, writer, params, client.Auth, client.Options...)
+}
+{{- end }}
+{{ end }}
+// Register{{ $svc }} registers the handlers of {{ $svc }} methods served
+// by impl.
+func Register{{ $svc }}(svc *dsrpc.Service, impl {{ $svc }}) {
+{{- range .Methods }}
+{{- if eq .Kind "exec" }}
+	{{ $svc }}{{ .Name }}.Handler(svc, func(content *dsrpc.Content, params *{{ .Params }}) (*{{ .Result }}, error) {
+		return impl.{{ .Name }}(content.Context(), params)
+	}{{ .Options }})
+{{- else if eq .Kind "put" }}
+	{{ $svc }}{{ .Name }}.Handler(svc, func(content *dsrpc.Content, params *{{ .Params }}) (*{{ .Result }}, error) {
+		reader := content.BinReader()
+		if content.BinSize() != dsrpc.ChunkedSize {
+			reader = io.LimitReader(reader, content.BinSize())
+		}
+		return impl.{{ .Name }}(content.Context(), reader, content.BinSize(), params)
+	}{{ .Options }})
+{{- else }}
+	{{ $svc }}{{ .Name }}.Handler(svc, func(content *dsrpc.Content, params *{{ .Params }}) (*{{ .Result }}, error) {
+		// The result is known after the data, so it goes in the trailer.
+		err := content.EnableTrailer()
+		if err != nil {
+			return nil, err
+		}
+		writer, err := content.SendResultChunked(dsrpc.NewEmptyResult())
+		if err != nil {
+			return nil, err
+		}
+		result, err := impl.{{ .Name }}(content.Context(), writer, params)
+		if err != nil {
+			return nil, err
+		}
+		return nil, content.SendTrailer(result, nil)
+	}{{ .Options }})
+{{- end }}
+{{- end }}
+}
+
+// {{ $svc }}Mock implements {{ $svc }} with replaceable functions. Methods
+// without a function return an error.
+type {{ $svc }}Mock struct {
+{{- range .Methods }}
+{{- if eq .Kind "exec" }}
+	{{ .Name }}Func func(ctx context.Context, params *{{ .Params }}) (*{{ .Result }}, error)
+{{- else if eq .Kind "put" }}
+	{{ .Name }}Func func(ctx context.Context, reader io.Reader, size int64, params *{{ .Params }}) (*{{ .Result }}, error)
+{{- else }}
+	{{ .Name }}Func func(ctx context.Context, writer io.Writer, params *{{ .Params }}) (*{{ .Result }}, error)
+{{- end }}
+{{- end }}
+}
+
+var _ {{ $svc }} = (*{{ $svc }}Mock)(nil)
+{{ range .Methods }}
+{{- if eq .Kind "exec" }}
+func (mock *{{ $svc }}Mock) {{ .Name }}(ctx context.Context, params *{{ .Params }}) (*{{ .Result }}, error) {
+	if mock.{{ .Name }}Func == nil {
+		return nil, errors.New("{{ $svc }}Mock.{{ .Name }} is not implemented")
+	}
+	return mock.{{ .Name }}Func(ctx, params)
+}
+{{- else if eq .Kind "put" }}
+func (mock *{{ $svc }}Mock) {{ .Name }}(ctx context.Context, reader io.Reader, size int64, params *{{ .Params }}) (*{{ .Result }}, error) {
+	if mock.{{ .Name }}Func == nil {
+		return nil, errors.New("{{ $svc }}Mock.{{ .Name }} is not implemented")
+	}
+	return mock.{{ .Name }}Func(ctx, reader, size, params)
+}
+{{- else }}
+func (mock *{{ $svc }}Mock) {{ .Name }}(ctx context.Context, writer io.Writer, params *{{ .Params }}) (*{{ .Result }}, error) {
+	if mock.{{ .Name }}Func == nil {
+		return nil, errors.New("{{ $svc }}Mock.{{ .Name }} is not implemented")
+	}
+	return mock.{{ .Name }}Func(ctx, writer, params)
+}
+{{- end }}
+{{ end }}`))
+
+type templateData struct {
+	*Service
+	HasBin bool
+}
+
+// Options returns the registration options of the method as trailing
+// call arguments.
+func (method *Method) Options() string {
+	var options string
+	if method.Description != "" {
+		options += ", dsrpc.WithDescription(" + strconv.Quote(method.Description) + ")"
+	}
+	switch method.Kind {
+	case kindPut:
+		options += ", dsrpc.WithBinaryIn()"
+	case kindGet:
+		options += ", dsrpc.WithBinaryOut()"
+	}
+	return options
+}
+
+func generate(service *Service) ([]byte, error) {
+	data := templateData{
+		Service: service,
+	}
+	for _, method := range service.Methods {
+		if method.Kind != kindExec {
+			data.HasBin = true
+		}
+	}
+	buffer := bytes.NewBuffer(nil)
+	err := codeTemplate.Execute(buffer, data)
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buffer.Bytes())
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+// Dsrpcgen generates a typed dsrpc client, a server adapter and a mock
+// from an annotated Go interface.
+//
+// Usage:
+//
+//	//go:generate go run github.com/kindsoldier/dsrpc/cmd/dsrpcgen -type HelloService
+//
+//	//dsrpc:service
+//	type HelloService interface {
+//	    //dsrpc:method hello
+//	    Hello(ctx context.Context, params *HelloParams) (*HelloResult, error)
+//	    Save(ctx context.Context, reader io.Reader, size int64, params *SaveParams) (*SaveResult, error)
+//	    Load(ctx context.Context, writer io.Writer, params *LoadParams) (*LoadResult, error)
+//	}
+//
+// The method kind follows from the signature: a plain call, an upload
+// taking an io.Reader with its size, or a download taking an io.Writer.
+// Methods are named "Interface.Method" unless a //dsrpc:method comment
+// gives the name.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	var typeName string
+	var output string
+	flag.StringVar(&typeName, "type", "", "interface type name")
+	flag.StringVar(&output, "output", "", "output file name, default <type>_dsrpc.go")
+	flag.Parse()
+
+	err := run(typeName, output, flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dsrpcgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(typeName, output string, args []string) error {
+	var err error
+	if typeName == "" {
+		return fmt.Errorf("missing -type")
+	}
+	source := os.Getenv("GOFILE")
+	if len(args) > 0 {
+		source = args[0]
+	}
+	if source == "" {
+		return fmt.Errorf("missing source file")
+	}
+	srcBytes, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	service, err := parseService(source, srcBytes, typeName)
+	if err != nil {
+		return err
+	}
+	code, err := generate(service)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		output = strings.ToLower(typeName) + "_dsrpc.go"
+		output = filepath.Join(filepath.Dir(source), output)
+	}
+	err = os.WriteFile(output, code, 0644)
+	if err != nil {
+		return err
+	}
+	return err
+}
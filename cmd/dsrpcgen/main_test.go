@@ -0,0 +1,225 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testSource = `package api
+
+import (
+	"context"
+	"io"
+
+	"example.com/types"
+)
+
+//dsrpc:service
+type Storage interface {
+	// Hello greets the caller.
+	//dsrpc:method hello
+	Hello(ctx context.Context, params *HelloParams) (*HelloResult, error)
+	Save(ctx context.Context, reader io.Reader, size int64, params *types.SaveParams) (*types.SaveResult, error)
+	Load(ctx context.Context, writer io.Writer, params *LoadParams) (*LoadResult, error)
+}
+
+type Plain interface {
+	Hello(ctx context.Context, params *HelloParams) (*HelloResult, error)
+}
+
+//dsrpc:service
+type Broken interface {
+	Hello(params *HelloParams) (*HelloResult, error)
+}
+`
+
+func TestParseService(t *testing.T) {
+	service, err := parseService("api.go", []byte(testSource), "Storage")
+	require.NoError(t, err)
+	require.Equal(t, "api", service.Package)
+	require.Equal(t, []string{`"example.com/types"`}, service.Imports)
+	require.Len(t, service.Methods, 3)
+
+	require.Equal(t, "hello", service.Methods[0].RPC)
+	require.Equal(t, kindExec, service.Methods[0].Kind)
+	require.Equal(t, "Hello greets the caller.", service.Methods[0].Description)
+
+	require.Equal(t, "Storage.Save", service.Methods[1].RPC)
+	require.Equal(t, kindPut, service.Methods[1].Kind)
+	require.Equal(t, "types.SaveParams", service.Methods[1].Params)
+	require.Equal(t, "types.SaveResult", service.Methods[1].Result)
+
+	require.Equal(t, kindGet, service.Methods[2].Kind)
+
+	_, err = parseService("api.go", []byte(testSource), "Plain")
+	require.Error(t, err)
+
+	_, err = parseService("api.go", []byte(testSource), "Broken")
+	require.Error(t, err)
+}
+
+func TestGenerate(t *testing.T) {
+	service, err := parseService("api.go", []byte(testSource), "Storage")
+	require.NoError(t, err)
+
+	code, err := generate(service)
+	require.NoError(t, err)
+
+	text := string(code)
+	require.Contains(t, text, `StorageHello = dsrpc.Method[HelloParams, HelloResult]("hello")`)
+	require.Contains(t, text, "func NewStorageClient(address string, auth *dsrpc.Auth) *StorageClient")
+	require.Contains(t, text, "func RegisterStorage(svc *dsrpc.Service, impl Storage)")
+	require.Contains(t, text, "type StorageMock struct")
+	require.Contains(t, text, `dsrpc.WithDescription("Hello greets the caller.")`)
+	require.Contains(t, text, "dsrpc.WithBinaryIn()")
+	require.Contains(t, text, "dsrpc.WithBinaryOut()")
+	require.Contains(t, text, `"example.com/types"`)
+}
+
+const roundTripSource = `package main
+
+import (
+	"context"
+	"io"
+)
+
+//dsrpc:service
+type Blob interface {
+	Hello(ctx context.Context, params *HelloParams) (*HelloResult, error)
+	Save(ctx context.Context, reader io.Reader, size int64, params *HelloParams) (*SizeResult, error)
+	Load(ctx context.Context, writer io.Writer, params *HelloParams) (*SizeResult, error)
+}
+
+type HelloParams struct {
+	Message string ` + "`json:\"message\"`" + `
+}
+
+type HelloResult struct {
+	Message string ` + "`json:\"message\"`" + `
+}
+
+type SizeResult struct {
+	Size int64 ` + "`json:\"size\"`" + `
+}
+`
+
+const roundTripMain = `package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/kindsoldier/dsrpc"
+)
+
+type blob struct{}
+
+func (blob) Hello(ctx context.Context, params *HelloParams) (*HelloResult, error) {
+	return &HelloResult{Message: strings.ToUpper(params.Message)}, nil
+}
+
+func (blob) Save(ctx context.Context, reader io.Reader, size int64, params *HelloParams) (*SizeResult, error) {
+	read, err := io.Copy(io.Discard, reader)
+	return &SizeResult{Size: read}, err
+}
+
+func (blob) Load(ctx context.Context, writer io.Writer, params *HelloParams) (*SizeResult, error) {
+	written, err := io.Copy(writer, strings.NewReader(params.Message))
+	return &SizeResult{Size: written}, err
+}
+
+func check(ok bool, format string, args ...any) {
+	if !ok {
+		fmt.Printf(format+"\n", args...)
+		os.Exit(1)
+	}
+}
+
+func main() {
+	dsrpc.SetAccessWriter(io.Discard)
+	dsrpc.SetMessageWriter(io.Discard)
+	serv := dsrpc.NewService()
+	RegisterBlob(serv, blob{})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	check(err == nil, "listen: %v", err)
+	go serv.Serve(listener)
+	defer serv.Stop()
+
+	ctx := context.Background()
+	client := NewBlobClient(listener.Addr().String(), nil)
+	hello, err := client.Hello(ctx, &HelloParams{Message: "hi"})
+	check(err == nil && hello.Message == "HI", "hello: %v %v", hello, err)
+
+	data := bytes.Repeat([]byte("data"), 100000)
+	saved, err := client.Save(ctx, bytes.NewReader(data), int64(len(data)), &HelloParams{})
+	check(err == nil && saved.Size == int64(len(data)), "save: %v %v", saved, err)
+	saved, err = client.Save(ctx, bytes.NewReader(data), dsrpc.ChunkedSize, &HelloParams{})
+	check(err == nil && saved.Size == int64(len(data)), "save stream: %v %v", saved, err)
+
+	buffer := bytes.NewBuffer(nil)
+	loaded, err := client.Load(ctx, buffer, &HelloParams{Message: string(data)})
+	check(err == nil && loaded.Size == int64(len(data)), "load: %v %v", loaded, err)
+	check(bytes.Equal(buffer.Bytes(), data), "load data: %d bytes", buffer.Len())
+
+	mock := &BlobMock{}
+	_, err = mock.Hello(ctx, &HelloParams{})
+	check(err != nil, "mock without function")
+	fmt.Println("OK")
+}
+`
+
+// TestGenerateRoundTrip compiles the generated code and calls a service
+// through the generated client and adapter.
+func TestGenerateRoundTrip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiles a program")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	require.NoError(t, err)
+
+	service, err := parseService("blob.go", []byte(roundTripSource), "Blob")
+	require.NoError(t, err)
+	code, err := generate(service)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	goMod := "module roundtrip\n\ngo 1.19\n\n" +
+		"require github.com/kindsoldier/dsrpc v0.0.0\n\n" +
+		"replace github.com/kindsoldier/dsrpc => " + root + "\n"
+	sums, err := os.ReadFile(filepath.Join(root, "go.sum"))
+	require.NoError(t, err)
+	files := map[string][]byte{
+		"go.mod":        []byte(goMod),
+		"go.sum":        sums,
+		"blob.go":       []byte(roundTripSource),
+		"blob_dsrpc.go": code,
+		"main.go":       []byte(roundTripMain),
+	}
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0644))
+	}
+
+	cmd := exec.Command(goBin, "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off")
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	require.Equal(t, "OK\n", string(output))
+}
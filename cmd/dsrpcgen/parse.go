@@ -0,0 +1,223 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	serviceMark = "dsrpc:service"
+	methodMark  = "dsrpc:method"
+)
+
+const (
+	kindExec = "exec"
+	kindPut  = "put"
+	kindGet  = "get"
+)
+
+type Service struct {
+	Package string
+	Name    string
+	Imports []string
+	Methods []*Method
+}
+
+type Method struct {
+	Name        string
+	RPC         string
+	Kind        string
+	Params      string
+	Result      string
+	Description string
+}
+
+func parseService(fileName string, source []byte, typeName string) (*Service, error) {
+	var err error
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, fileName, source, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var iface *ast.InterfaceType
+	var doc *ast.CommentGroup
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			if typeSpec.Name.Name != typeName {
+				continue
+			}
+			iface, ok = typeSpec.Type.(*ast.InterfaceType)
+			if !ok {
+				return nil, fmt.Errorf("%s is not an interface", typeName)
+			}
+			doc = typeSpec.Doc
+			if doc == nil {
+				doc = genDecl.Doc
+			}
+		}
+	}
+	if iface == nil {
+		return nil, fmt.Errorf("interface %s not found in %s", typeName, fileName)
+	}
+	if _, ok := findMark(doc, serviceMark); !ok {
+		return nil, fmt.Errorf("interface %s has no //%s comment", typeName, serviceMark)
+	}
+
+	service := &Service{
+		Package: file.Name.Name,
+		Name:    typeName,
+		Methods: make([]*Method, 0),
+	}
+	selectors := make(map[string]bool)
+	for _, field := range iface.Methods.List {
+		funcType, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded interfaces are not supported", typeName)
+		}
+		name := field.Names[0].Name
+		method, err := parseMethod(name, funcType)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", typeName, name, err)
+		}
+		method.RPC = typeName + "." + name
+		if rpcName, ok := findMark(field.Doc, methodMark); ok && rpcName != "" {
+			method.RPC = rpcName
+		}
+		method.Description = docText(field.Doc)
+		collectSelectors(funcType, selectors)
+		service.Methods = append(service.Methods, method)
+	}
+
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if !selectors[name] || name == "context" || name == "io" {
+			continue
+		}
+		service.Imports = append(service.Imports, spec.Path.Value)
+		if spec.Name != nil {
+			service.Imports[len(service.Imports)-1] = spec.Name.Name + " " + spec.Path.Value
+		}
+	}
+	sort.Strings(service.Imports)
+	return service, err
+}
+
+func parseMethod(name string, funcType *ast.FuncType) (*Method, error) {
+	var err error
+	params := flatten(funcType.Params)
+	results := flatten(funcType.Results)
+
+	if len(results) != 2 || !isPointer(results[0]) || types.ExprString(results[1]) != "error" {
+		return nil, fmt.Errorf("results must be (*Result, error)")
+	}
+	if len(params) < 2 || types.ExprString(params[0]) != "context.Context" {
+		return nil, fmt.Errorf("first argument must be context.Context")
+	}
+	method := &Method{
+		Name:   name,
+		Result: types.ExprString(results[0].(*ast.StarExpr).X),
+	}
+
+	var last ast.Expr
+	switch {
+	case len(params) == 2:
+		method.Kind = kindExec
+		last = params[1]
+	case len(params) == 3 && types.ExprString(params[1]) == "io.Writer":
+		method.Kind = kindGet
+		last = params[2]
+	case len(params) == 4 && types.ExprString(params[1]) == "io.Reader" && types.ExprString(params[2]) == "int64":
+		method.Kind = kindPut
+		last = params[3]
+	default:
+		return nil, fmt.Errorf("unsupported arguments")
+	}
+	if !isPointer(last) {
+		return nil, fmt.Errorf("params must be a pointer")
+	}
+	method.Params = types.ExprString(last.(*ast.StarExpr).X)
+	return method, err
+}
+
+func flatten(fields *ast.FieldList) []ast.Expr {
+	exprs := make([]ast.Expr, 0)
+	if fields == nil {
+		return exprs
+	}
+	for _, field := range fields.List {
+		count := len(field.Names)
+		if count == 0 {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			exprs = append(exprs, field.Type)
+		}
+	}
+	return exprs
+}
+
+func isPointer(expr ast.Expr) bool {
+	_, ok := expr.(*ast.StarExpr)
+	return ok
+}
+
+func collectSelectors(node ast.Node, selectors map[string]bool) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		selector, ok := node.(*ast.SelectorExpr)
+		if ok {
+			if ident, ok := selector.X.(*ast.Ident); ok {
+				selectors[ident.Name] = true
+			}
+		}
+		return true
+	})
+}
+
+func docText(doc *ast.CommentGroup) string {
+	lines := make([]string, 0)
+	if doc == nil {
+		return ""
+	}
+	for _, line := range strings.Split(doc.Text(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "dsrpc:") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, " ")
+}
+
+func findMark(doc *ast.CommentGroup, mark string) (string, bool) {
+	if doc == nil {
+		return "", false
+	}
+	for _, comment := range doc.List {
+		text := strings.TrimPrefix(comment.Text, "//")
+		if !strings.HasPrefix(text, mark) {
+			continue
+		}
+		return strings.TrimSpace(strings.TrimPrefix(text, mark)), true
+	}
+	return "", false
+}
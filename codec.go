@@ -0,0 +1,382 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Codec encodes the request and response blocks. The codec id travels in
+// the packet header and the server answers with the codec of the request.
+type Codec interface {
+	Id() byte
+	Name() string
+	Marshal(value any) ([]byte, error)
+	Unmarshal(data []byte, value any) error
+}
+
+const (
+	jsonCodecId    byte = 0
+	gobCodecId     byte = 1
+	msgpackCodecId byte = 2
+)
+
+var (
+	JsonCodec Codec = jsonCodec{}
+	// StrictJsonCodec writes plain JSON but rejects unknown fields and
+	// decodes numbers into interface values as json.Number, keeping
+	// int64 precision.
+	StrictJsonCodec Codec = jsonCodec{strict: true}
+	GobCodec        Codec = gobCodec{}
+	MsgpackCodec    Codec = msgpackCodec{}
+)
+
+var codecs sync.Map
+
+func init() {
+	RegisterCodec(JsonCodec)
+	RegisterCodec(GobCodec)
+	RegisterCodec(MsgpackCodec)
+}
+
+// RegisterCodec makes the codec available to decode incoming packets.
+// Ids up to 15 fit in the header.
+func RegisterCodec(codec Codec) {
+	codecs.Store(codec.Id(), codec)
+}
+
+func codecById(id byte) (Codec, error) {
+	codec, ok := codecs.Load(id)
+	if !ok {
+		return nil, fmt.Errorf("unsupported codec %d", id)
+	}
+	return codec.(Codec), nil
+}
+
+type jsonCodec struct {
+	strict bool
+}
+
+func (codec jsonCodec) Id() byte {
+	return jsonCodecId
+}
+
+func (codec jsonCodec) Name() string {
+	if codec.strict {
+		return "strict-json"
+	}
+	return "json"
+}
+
+func (codec jsonCodec) Marshal(value any) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (codec jsonCodec) Unmarshal(data []byte, value any) error {
+	if !codec.strict {
+		return json.Unmarshal(data, value)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	decoder.UseNumber()
+	err := decoder.Decode(value)
+	if err == nil {
+		return err
+	}
+	rtype := reflect.TypeOf(value)
+	if rtype == nil || rtype.Kind() != reflect.Pointer {
+		return err
+	}
+	// The data fits the value but for its unknown fields.
+	decoder = json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if decoder.Decode(reflect.New(rtype.Elem()).Interface()) != nil {
+		return err
+	}
+	name, ok := unknownField(data, rtype, "")
+	if !ok {
+		return err
+	}
+	return &UnknownFieldError{Field: name}
+}
+
+// UnknownFieldError is returned by StrictJsonCodec for a field of the data
+// which the value does not have. Field is the path of the field.
+type UnknownFieldError struct {
+	Field string
+}
+
+func (ferr *UnknownFieldError) Error() string {
+	return fmt.Sprintf("unknown field %s", ferr.Field)
+}
+
+// unknownField returns the path of the first field of the JSON data which
+// the type does not have.
+func unknownField(data []byte, rtype reflect.Type, path string) (string, bool) {
+	for rtype.Kind() == reflect.Pointer {
+		rtype = rtype.Elem()
+	}
+	switch rtype.Kind() {
+	case reflect.Struct, reflect.Map:
+		object := make(map[string]json.RawMessage)
+		if json.Unmarshal(data, &object) != nil {
+			return "", false
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			elemType := rtype
+			if rtype.Kind() == reflect.Map {
+				keyPath = fmt.Sprintf("%s[%s]", path, key)
+				elemType = rtype.Elem()
+			} else {
+				field, ok := jsonField(rtype, key)
+				if !ok {
+					return keyPath, true
+				}
+				elemType = field.Type
+			}
+			name, ok := unknownField(object[key], elemType, keyPath)
+			if ok {
+				return name, ok
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if json.Unmarshal(data, &items) != nil {
+			return "", false
+		}
+		for i, item := range items {
+			name, ok := unknownField(item, rtype.Elem(), fmt.Sprintf("%s[%d]", path, i))
+			if ok {
+				return name, ok
+			}
+		}
+	}
+	return "", false
+}
+
+// jsonField finds the struct field of a JSON key as encoding/json does,
+// with the exact name first and then ignoring the case.
+func jsonField(rtype reflect.Type, key string) (reflect.StructField, bool) {
+	var folded reflect.StructField
+	found := false
+	for i := 0; i < rtype.NumField(); i++ {
+		field := rtype.Field(i)
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inner, ok := jsonField(embedded, key)
+				if ok && fieldName(inner) == key {
+					return inner, ok
+				}
+				if ok && !found {
+					folded, found = inner, true
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name := fieldName(field)
+		if name == key {
+			return field, true
+		}
+		if name != "" && !found && strings.EqualFold(name, key) {
+			folded, found = field, true
+		}
+	}
+	return folded, found
+}
+
+type gobCodec struct{}
+
+func (codec gobCodec) Id() byte {
+	return gobCodecId
+}
+
+func (codec gobCodec) Name() string {
+	return "gob"
+}
+
+func (codec gobCodec) Marshal(value any) ([]byte, error) {
+	buffer := bytes.NewBuffer(nil)
+	err := gob.NewEncoder(buffer).Encode(value)
+	return buffer.Bytes(), err
+}
+
+func (codec gobCodec) Unmarshal(data []byte, value any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(value)
+}
+
+type msgpackCodec struct{}
+
+func (codec msgpackCodec) Id() byte {
+	return msgpackCodecId
+}
+
+func (codec msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (codec msgpackCodec) Marshal(value any) ([]byte, error) {
+	return MarshalMsgpack(value)
+}
+
+func (codec msgpackCodec) Unmarshal(data []byte, value any) error {
+	return UnmarshalMsgpack(data, value)
+}
+
+// gobValue encodes a value of a block field which gob can not carry as
+// an interface. Empty params and results are sent as no bytes.
+func gobValue(value any) ([]byte, error) {
+	switch value := value.(type) {
+	case nil, *EmptyParams, EmptyParams, *EmptyResult, EmptyResult:
+		return nil, nil
+	case *rawValue:
+		return *value, nil
+	}
+	if !hasExportedFields(value) {
+		return nil, nil
+	}
+	return GobCodec.Marshal(value)
+}
+
+// hasExportedFields reports false for structs which gob refuses to encode.
+func hasExportedFields(value any) bool {
+	rtype := reflect.TypeOf(value)
+	for rtype.Kind() == reflect.Pointer {
+		rtype = rtype.Elem()
+	}
+	if rtype.Kind() != reflect.Struct {
+		return true
+	}
+	for i := 0; i < rtype.NumField(); i++ {
+		if rtype.Field(i).IsExported() {
+			return true
+		}
+	}
+	return false
+}
+
+func gobBind(data []byte, value any) error {
+	var err error
+	switch value := value.(type) {
+	case nil, *EmptyParams, *EmptyResult:
+		return err
+	case *rawValue:
+		*value = append((*value)[0:0], data...)
+		return err
+	}
+	if len(data) == 0 {
+		return err
+	}
+	return GobCodec.Unmarshal(data, value)
+}
+
+type gobRequest struct {
+	Method string
+	Params []byte
+	Auth   *Auth
+	Meta   Metadata
+
+	Attachments []Attachment
+	Range       *Range
+}
+
+func (req *Request) GobEncode() ([]byte, error) {
+	params, err := gobValue(req.Params)
+	if err != nil {
+		return nil, err
+	}
+	block := gobRequest{
+		Method: req.Method,
+		Params: params,
+		Auth:   req.Auth,
+		Meta:   req.Meta,
+
+		Attachments: req.Attachments,
+		Range:       req.Range,
+	}
+	return GobCodec.Marshal(block)
+}
+
+func (req *Request) GobDecode(data []byte) error {
+	block := gobRequest{}
+	err := GobCodec.Unmarshal(data, &block)
+	if err != nil {
+		return err
+	}
+	req.Method = block.Method
+	req.Meta = block.Meta
+	req.Attachments = block.Attachments
+	req.Range = block.Range
+	if block.Auth != nil {
+		req.Auth = block.Auth
+	}
+	return gobBind(block.Params, req.Params)
+}
+
+type gobResponse struct {
+	Error   string
+	Fields  []FieldError
+	Result  []byte
+	Header  Metadata
+	Trailer Metadata
+
+	Attachments []Attachment
+	Range       *Range
+}
+
+func (resp *Response) GobEncode() ([]byte, error) {
+	result, err := gobValue(resp.Result)
+	if err != nil {
+		return nil, err
+	}
+	block := gobResponse{
+		Error:   resp.Error,
+		Fields:  resp.Fields,
+		Result:  result,
+		Header:  resp.Header,
+		Trailer: resp.Trailer,
+
+		Attachments: resp.Attachments,
+		Range:       resp.Range,
+	}
+	return GobCodec.Marshal(block)
+}
+
+func (resp *Response) GobDecode(data []byte) error {
+	block := gobResponse{}
+	err := GobCodec.Unmarshal(data, &block)
+	if err != nil {
+		return err
+	}
+	resp.Error = block.Error
+	resp.Fields = block.Fields
+	resp.Header = block.Header
+	resp.Trailer = block.Trailer
+	resp.Attachments = block.Attachments
+	resp.Range = block.Range
+	return gobBind(block.Result, resp.Result)
+}
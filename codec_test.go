@@ -0,0 +1,202 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mpInner struct {
+	Values []int64 `msgpack:"values"`
+}
+
+type mpSample struct {
+	Name    string            `msgpack:"name"`
+	Count   int64             `msgpack:"count"`
+	Small   int8              `msgpack:"small"`
+	Size    uint64            `msgpack:"size"`
+	Ratio   float64           `msgpack:"ratio"`
+	Flag    bool              `msgpack:"flag"`
+	Data    []byte            `msgpack:"data"`
+	Created time.Time         `msgpack:"created"`
+	Labels  map[string]string `msgpack:"labels"`
+	Inner   *mpInner          `msgpack:"inner"`
+	Items   []mpInner         `msgpack:"items"`
+	Note    string            `msgpack:"note,omitempty"`
+	Extra   any               `json:"extra"`
+	Skip    string            `msgpack:"-"`
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	sample := mpSample{
+		Name:    strings.Repeat("x", 300),
+		Count:   math.MaxInt64,
+		Small:   -100,
+		Size:    math.MaxUint64,
+		Ratio:   -0.125,
+		Flag:    true,
+		Data:    []byte{0, 1, 2, 255},
+		Created: time.Unix(1700000000, 123456789),
+		Labels:  map[string]string{"a": "b"},
+		Inner:   &mpInner{Values: []int64{-1, -33, 128, -40000, 1 << 40}},
+		Items:   make([]mpInner, 20),
+		Extra:   map[string]any{"k": int64(7)},
+		Skip:    "skip",
+	}
+	data, err := MarshalMsgpack(&sample)
+	require.NoError(t, err)
+
+	decoded := mpSample{}
+	err = UnmarshalMsgpack(data, &decoded)
+	require.NoError(t, err)
+	require.True(t, sample.Created.Equal(decoded.Created))
+	decoded.Created = sample.Created
+	sample.Skip = ""
+	require.Equal(t, sample, decoded)
+
+	var generic any
+	err = UnmarshalMsgpack(data, &generic)
+	require.NoError(t, err)
+	require.Equal(t, int64(math.MaxInt64), generic.(map[string]any)["count"])
+	require.NotContains(t, generic.(map[string]any), "note")
+
+	err = UnmarshalMsgpack(data[:len(data)-3], &decoded)
+	require.Error(t, err)
+}
+
+func TestMsgpackLimits(t *testing.T) {
+	// Deep nesting ends with an error, not a stack overflow.
+	depth := 100000
+	data := append(bytes.Repeat([]byte{0x91}, depth), mpNil)
+	var generic any
+	err := UnmarshalMsgpack(data, &generic)
+	require.ErrorIs(t, err, errMsgpackDepth)
+	err = UnmarshalMsgpack(data, &rawValue{})
+	require.ErrorIs(t, err, errMsgpackDepth)
+	var nested [][][]any
+	err = UnmarshalMsgpack(data, &nested)
+	require.ErrorIs(t, err, errMsgpackDepth)
+
+	// The request block keeps the params encoded and decodes the other
+	// fields.
+	for _, key := range []string{"params", "other"} {
+		block := append([]byte{0x81, 0xa0 | byte(len(key))}, key...)
+		request := NewEmptyRequest()
+		request.Params = &rawValue{}
+		err = UnmarshalMsgpack(append(block, data...), request)
+		require.ErrorIs(t, err, errMsgpackDepth, key)
+	}
+
+	// A long array header is not allocated before its elements.
+	size := 1 << 20
+	data = []byte{mpArray32, 0, 0, 0, 0, mpStr32, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(data[1:], uint32(size))
+	binary.BigEndian.PutUint32(data[6:], uint32(size))
+	data = append(data, make([]byte, size)...)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	var wide [][1024]byte
+	err = UnmarshalMsgpack(data, &wide)
+	runtime.ReadMemStats(&after)
+	require.Error(t, err)
+	require.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(64<<20))
+}
+
+type strictInner struct {
+	Name string `json:"name"`
+}
+
+type strictSample struct {
+	strictInner
+	Count int                    `json:"count"`
+	Items []strictInner          `json:"items"`
+	Table map[string]strictInner `json:"table"`
+	Extra any                    `json:"extra"`
+}
+
+func TestStrictJsonUnknownField(t *testing.T) {
+	sample := &strictSample{}
+	err := StrictJsonCodec.Unmarshal([]byte(`{"NAME":"a","Count":1,"extra":{"any":1}}`), sample)
+	require.NoError(t, err)
+	require.Equal(t, "a", sample.Name)
+
+	for data, field := range map[string]string{
+		`{"count":1,"size":2}`:              "size",
+		`{"items":[{"name":"a"},{"id":1}]}`: "items[1].id",
+		`{"table":{"a":{"id":1}}}`:          "table[a].id",
+	} {
+		err = StrictJsonCodec.Unmarshal([]byte(data), &strictSample{})
+		var ferr *UnknownFieldError
+		require.ErrorAs(t, err, &ferr, data)
+		require.Equal(t, field, ferr.Field)
+	}
+
+	// Other errors are returned as is.
+	err = StrictJsonCodec.Unmarshal([]byte(`{"count":"a","size":2}`), sample)
+	require.Error(t, err)
+	var ferr *UnknownFieldError
+	require.False(t, errors.As(err, &ferr))
+}
+
+func TestHeaderFlags(t *testing.T) {
+	header := NewEmptyHeader()
+	header.rpcSize = 10
+	header.setCodecId(MsgpackCodec.Id())
+	headerBytes, err := header.Pack()
+	require.NoError(t, err)
+	require.Len(t, headerBytes, int(headerSize))
+
+	unpacked, err := UnpackHeader(headerBytes)
+	require.NoError(t, err)
+	require.Equal(t, MsgpackCodec.Id(), unpacked.codecId())
+	require.Equal(t, int64(10), unpacked.rpcSize)
+
+	// A header without flags is packed as before.
+	legacy := NewEmptyHeader()
+	legacyBytes, err := legacy.Pack()
+	require.NoError(t, err)
+	require.Equal(t, EncoderI64(magicCodeB), legacyBytes[24:32])
+}
+
+func TestCodecLocalExec(t *testing.T) {
+	for _, codec := range []Codec{JsonCodec, StrictJsonCodec, GobCodec, MsgpackCodec} {
+		params := HelloParams{Message: "hello server!"}
+		result := HelloResult{}
+		auth := CreateAuth([]byte("qwert"), []byte("12345"))
+
+		err := LocalExec(HelloMethod, &params, &result, auth, helloHandler, WithCodec(codec))
+		require.NoError(t, err, codec.Name())
+		require.Equal(t, "hello, client!", result.Message, codec.Name())
+
+		_, err = typedHello.LocalExec(&HelloParams{}, nil, typedHelloHandler, WithCodec(codec))
+		require.Error(t, err, codec.Name())
+		require.Equal(t, "empty message", err.Error(), codec.Name())
+	}
+}
+
+func TestCodecLocalGet(t *testing.T) {
+	for _, codec := range []Codec{GobCodec, MsgpackCodec} {
+		params := LoadParams{Message: "load data!"}
+		result := LoadResult{}
+		writer := bytes.NewBuffer(nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := LocalGet(ctx, LoadMethod, writer, &params, &result, nil, loadHandler, WithCodec(codec))
+		cancel()
+		require.NoError(t, err, codec.Name())
+		require.Equal(t, "load successfully!", result.Message, codec.Name())
+		require.Equal(t, 1024, writer.Len(), codec.Name())
+	}
+}
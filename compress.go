@@ -0,0 +1,419 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Compressor compresses the request and response blocks and the binary
+// data. The compressor id travels in the packet header.
+type Compressor interface {
+	Id() byte
+	Name() string
+	NewWriter(writer io.Writer) (io.WriteCloser, error)
+	NewReader(reader io.Reader) (io.ReadCloser, error)
+}
+
+const (
+	flateCompressorId byte = 1
+	gzipCompressorId  byte = 2
+)
+
+var (
+	FlateCompressor Compressor = flateCompressor{}
+	GzipCompressor  Compressor = gzipCompressor{}
+)
+
+// DefaultCompressThreshold is the size below which blocks and binary
+// data are sent uncompressed.
+const DefaultCompressThreshold int64 = 1024
+
+// DefaultMaxBlockSize is the largest size of a block read, before and
+// after decompression.
+const DefaultMaxBlockSize int64 = 64 * 1024 * 1024
+
+// ErrBlockTooLarge is returned for a block which is larger than the
+// maximum block size as received or decompressed.
+var ErrBlockTooLarge = errors.New("block too large")
+
+// WithMaxBlockSize sets the largest size of a response block read by the
+// call.
+func WithMaxBlockSize(size int64) CallOption {
+	return func(content *Content) {
+		content.blockMax = size
+	}
+}
+
+// The metadata keys which carry the compressors accepted by the client.
+const (
+	blockZipMetaKey = ReservedMetaPrefix + "block-compress"
+	binZipMetaKey   = ReservedMetaPrefix + "bin-compress"
+)
+
+var compressors sync.Map
+
+func init() {
+	RegisterCompressor(FlateCompressor)
+	RegisterCompressor(GzipCompressor)
+}
+
+// RegisterCompressor makes the compressor available for the calls. Ids
+// from 1 up to 15 fit in the header.
+func RegisterCompressor(compressor Compressor) {
+	compressors.Store(compressor.Id(), compressor)
+}
+
+func compressorById(id byte) (Compressor, error) {
+	compressor, ok := compressors.Load(id)
+	if !ok {
+		return nil, fmt.Errorf("unsupported compressor %d", id)
+	}
+	return compressor.(Compressor), nil
+}
+
+func compressorByName(name string) Compressor {
+	var found Compressor
+	compressors.Range(func(key, value any) bool {
+		compressor := value.(Compressor)
+		if compressor.Name() == name {
+			found = compressor
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+type flateCompressor struct{}
+
+func (compressor flateCompressor) Id() byte {
+	return flateCompressorId
+}
+
+func (compressor flateCompressor) Name() string {
+	return "flate"
+}
+
+func (compressor flateCompressor) NewWriter(writer io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(writer, flate.DefaultCompression)
+}
+
+func (compressor flateCompressor) NewReader(reader io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(reader), nil
+}
+
+type gzipCompressor struct{}
+
+func (compressor gzipCompressor) Id() byte {
+	return gzipCompressorId
+}
+
+func (compressor gzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (compressor gzipCompressor) NewWriter(writer io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(writer), nil
+}
+
+func (compressor gzipCompressor) NewReader(reader io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(reader)
+}
+
+// WithCompression compresses the blocks and the binary data of the call
+// and lets the server compress its response.
+func WithCompression(compressor Compressor) CallOption {
+	return func(content *Content) {
+		content.blockZip = compressor
+		content.binZip = compressor
+	}
+}
+
+// WithBlockCompression compresses the request and response blocks only.
+func WithBlockCompression(compressor Compressor) CallOption {
+	return func(content *Content) {
+		content.blockZip = compressor
+	}
+}
+
+// WithBinCompression compresses the binary data only.
+func WithBinCompression(compressor Compressor) CallOption {
+	return func(content *Content) {
+		content.binZip = compressor
+	}
+}
+
+// WithCompressThreshold sets the size below which the request block and
+// binary data are sent uncompressed.
+func WithCompressThreshold(size int64) CallOption {
+	return func(content *Content) {
+		content.zipMin = size
+	}
+}
+
+// requestCompression asks the server for compression and marks the
+// compressed binary data of the request.
+func (content *Content) requestCompression() {
+	if content.blockZip == nil && content.binZip == nil {
+		return
+	}
+	if content.reqBlock.Meta == nil {
+		content.reqBlock.Meta = make(Metadata)
+	}
+	if content.blockZip != nil {
+		content.reqBlock.Meta.Set(blockZipMetaKey, content.blockZip.Name())
+	}
+	if content.binZip != nil {
+		content.reqBlock.Meta.Set(binZipMetaKey, content.binZip.Name())
+		content.setBinZip(content.reqHeader)
+	}
+}
+
+// acceptCompression takes the compressors accepted by the client which
+// are known to the server. Others are ignored and the response is sent
+// uncompressed.
+func (content *Content) acceptCompression() {
+	name := content.reqBlock.Meta.Get(blockZipMetaKey)
+	if len(name) > 0 {
+		content.blockZip = compressorByName(name)
+	}
+	name = content.reqBlock.Meta.Get(binZipMetaKey)
+	if len(name) > 0 {
+		content.binZip = compressorByName(name)
+	}
+}
+
+// setBinZip marks the binary data of the packet as compressed if it is
+// large or of unknown size.
+func (content *Content) setBinZip(header *Header) {
+	if content.binZip == nil || header.binSize == 0 {
+		return
+	}
+	if header.binSize == ChunkedSize || header.binSize >= content.zipMin {
+		header.setBinZipId(content.binZip.Id())
+	}
+}
+
+// zipBlock compresses a large block and marks it in the header.
+func (content *Content) zipBlock(header *Header, block []byte) ([]byte, error) {
+	var err error
+	if content.blockZip == nil || int64(len(block)) < content.zipMin {
+		return block, err
+	}
+	buffer := bytes.NewBuffer(make([]byte, 0, len(block)/2))
+	writer, err := content.blockZip.NewWriter(buffer)
+	if err != nil {
+		return nil, err
+	}
+	_, err = writer.Write(block)
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	header.setBlockZipId(content.blockZip.Id())
+	return buffer.Bytes(), err
+}
+
+// unzipBlock decompresses the block of the packet if it is compressed.
+// The decompressed block is limited to limit bytes.
+func unzipBlock(header *Header, block []byte, limit int64) ([]byte, error) {
+	var err error
+	if header.blockZipId() == 0 {
+		return block, err
+	}
+	compressor, err := compressorById(header.blockZipId())
+	if err != nil {
+		return nil, err
+	}
+	reader, err := compressor.NewReader(bytes.NewReader(block))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	block, err = io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(block)) > limit {
+		return nil, ErrBlockTooLarge
+	}
+	return block, err
+}
+
+// binInputOf returns the reader of the binary data of the packet, which
+// may be chunked or compressed. The wire size of chunked data is added
+// to wire.
+func binInputOf(header *Header, reader io.Reader, wire *int64) (io.Reader, error) {
+	var err error
+	if header.binZipId() != 0 {
+		compressor, err := compressorById(header.binZipId())
+		if err != nil {
+			return nil, err
+		}
+		chunks := newChunkReader(reader)
+		chunks.wire = wire
+		return &zipReader{compressor: compressor, chunks: chunks, remains: header.binSize}, err
+	}
+	if header.binSize == ChunkedSize {
+		chunks := newChunkReader(reader)
+		chunks.wire = wire
+		return chunks, err
+	}
+	*wire = header.binSize
+	return reader, err
+}
+
+// binOutputOf returns the writer of the binary data of the packet. It
+// must be closed to end chunked and compressed data.
+func binOutputOf(header *Header, writer io.Writer, wire *int64) (io.WriteCloser, error) {
+	var err error
+	if header.binZipId() != 0 {
+		compressor, err := compressorById(header.binZipId())
+		if err != nil {
+			return nil, err
+		}
+		chunks := newChunkWriter(writer)
+		chunks.wire = wire
+		return newZipWriter(compressor, chunks, header.binSize)
+	}
+	if header.binSize == ChunkedSize {
+		chunks := newChunkWriter(writer)
+		chunks.wire = wire
+		return chunks, err
+	}
+	*wire = header.binSize
+	return nopWriteCloser{writer}, err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// zipWriter compresses the binary data into chunks. Data of known size
+// is closed with its last byte.
+type zipWriter struct {
+	chunks  *chunkWriter
+	writer  io.WriteCloser
+	remains int64
+	closed  bool
+}
+
+func newZipWriter(compressor Compressor, chunks *chunkWriter, size int64) (*zipWriter, error) {
+	writer, err := compressor.NewWriter(chunks)
+	if err != nil {
+		return nil, err
+	}
+	return &zipWriter{chunks: chunks, writer: writer, remains: size}, err
+}
+
+func (zip *zipWriter) Write(data []byte) (int, error) {
+	var err error
+	if zip.closed {
+		err = errors.New("write to closed stream")
+		return 0, err
+	}
+	written, err := zip.writer.Write(data)
+	if err != nil {
+		return written, err
+	}
+	if zip.remains >= 0 {
+		zip.remains -= int64(written)
+		if zip.remains <= 0 {
+			err = zip.Close()
+		}
+	}
+	return written, err
+}
+
+func (zip *zipWriter) Close() error {
+	var err error
+	if zip.closed {
+		return err
+	}
+	zip.closed = true
+	err = zip.writer.Close()
+	if err != nil {
+		return err
+	}
+	return zip.chunks.Close()
+}
+
+// zipReader decompresses the binary data from chunks. The end of the
+// chunks is read together with the last byte of the data, so a reader
+// which stops at the data size leaves the connection at the next frame.
+type zipReader struct {
+	compressor Compressor
+	chunks     *chunkReader
+	reader     io.ReadCloser
+	remains    int64
+	done       bool
+}
+
+func (zip *zipReader) Read(buffer []byte) (int, error) {
+	var err error
+	if zip.done {
+		return 0, io.EOF
+	}
+	if zip.reader == nil {
+		zip.reader, err = zip.compressor.NewReader(zip.chunks)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if zip.remains >= 0 && int64(len(buffer)) > zip.remains {
+		buffer = buffer[0:zip.remains]
+	}
+	read, err := zip.reader.Read(buffer)
+	if zip.remains >= 0 {
+		zip.remains -= int64(read)
+	}
+	if err == io.EOF && zip.remains > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil && err != io.EOF {
+		return read, err
+	}
+	if err == io.EOF || zip.remains == 0 {
+		zip.done = true
+		drainErr := zip.drain()
+		if drainErr != nil {
+			return read, drainErr
+		}
+	}
+	if zip.remains == 0 {
+		// The data of known size ends with its last byte.
+		err = nil
+	}
+	return read, err
+}
+
+// drain reads the rest of the compressed data and the end of the chunks.
+func (zip *zipReader) drain() error {
+	var err error
+	_, err = io.Copy(io.Discard, zip.reader)
+	if err != nil {
+		return err
+	}
+	err = zip.reader.Close()
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, zip.chunks)
+	return err
+}
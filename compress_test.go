@@ -0,0 +1,222 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	zipEchoMethod string = "zipEcho"
+	zipPutMethod  string = "zipPut"
+	zipGetMethod  string = "zipGet"
+)
+
+var zipData = bytes.Repeat([]byte("compressible log line\n"), 8192)
+
+type zipSizes struct {
+	RpcSize     int64  `json:"rpcSize"`
+	RpcWireSize int64  `json:"rpcWireSize"`
+	BinWireSize int64  `json:"binWireSize"`
+	Message     string `json:"message"`
+}
+
+func zipEchoHandler(content *Content) error {
+	var err error
+	params := &HelloParams{}
+	err = content.BindParams(params)
+	if err != nil {
+		return err
+	}
+	result := &zipSizes{
+		RpcSize:     content.ReqRpcSize(),
+		RpcWireSize: content.ReqRpcWireSize(),
+		Message:     params.Message,
+	}
+	return content.SendResult(result, 0)
+}
+
+func zipPutHandler(content *Content) error {
+	var err error
+	writer := bytes.NewBuffer(nil)
+	err = content.ReadBin(content.Context(), writer)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(zipData, writer.Bytes()) {
+		return content.SendError(io.ErrUnexpectedEOF)
+	}
+	result := &zipSizes{
+		BinWireSize: content.ReqBinWireSize(),
+		Message:     content.ReqDigest().String(),
+	}
+	return content.SendResult(result, 0)
+}
+
+func zipGetHandler(content *Content) error {
+	var err error
+	if content.Metadata().Get("chunked") == "yes" {
+		writer, err := content.SendResultChunked(NewEmptyResult())
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(zipData)
+		if err != nil {
+			return err
+		}
+		return writer.Close()
+	}
+	err = content.SendResult(NewEmptyResult(), int64(len(zipData)))
+	if err != nil {
+		return err
+	}
+	_, err = content.BinWriter().Write(zipData)
+	return err
+}
+
+func TestCompression(t *testing.T) {
+	serv := NewService()
+	serv.Handler(zipEchoMethod, zipEchoHandler)
+	serv.Handler(zipPutMethod, zipPutHandler)
+	serv.Handler(zipGetMethod, zipGetHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	message := strings.Repeat("large json document ", 1024)
+	for _, compressor := range []Compressor{FlateCompressor, GzipCompressor} {
+		params := &HelloParams{Message: message}
+		result := &zipSizes{}
+		err := Exec(ctx, address, zipEchoMethod, params, result, nil,
+			WithBlockCompression(compressor))
+		require.NoError(t, err, compressor.Name())
+		require.Equal(t, message, result.Message)
+		require.Less(t, result.RpcWireSize, result.RpcSize)
+	}
+
+	params := &HelloParams{Message: "short"}
+	result := &zipSizes{}
+	err := Exec(ctx, address, zipEchoMethod, params, result, nil,
+		WithCompression(GzipCompressor))
+	require.NoError(t, err)
+	require.Equal(t, result.RpcSize, result.RpcWireSize)
+
+	digest := Digest{}
+	reader := bytes.NewReader(zipData)
+	err = Put(ctx, address, zipPutMethod, reader, int64(len(zipData)), nil, result, nil,
+		WithCompression(GzipCompressor), WithDigest(DigestSHA256, &digest))
+	require.NoError(t, err)
+	require.Equal(t, digest.String(), result.Message)
+	require.Less(t, result.BinWireSize, int64(len(zipData)))
+
+	reader = bytes.NewReader(zipData)
+	err = PutStream(ctx, address, zipPutMethod, reader, nil, result, nil,
+		WithBinCompression(FlateCompressor), WithDigest(DigestCRC32C, nil))
+	require.NoError(t, err)
+	require.Less(t, result.BinWireSize, int64(len(zipData)))
+
+	for _, chunked := range []string{"no", "yes"} {
+		writer := bytes.NewBuffer(nil)
+		err = Get(ctx, address, zipGetMethod, writer, nil, nil, nil,
+			WithCompression(FlateCompressor), WithDigest(DigestSHA256, nil),
+			WithMetadata(NewMetadata("chunked", chunked)))
+		require.NoError(t, err, chunked)
+		require.Equal(t, zipData, writer.Bytes(), chunked)
+	}
+}
+
+func TestCompressionLocal(t *testing.T) {
+	// A compressor unknown to the server is ignored.
+	content := CreateContent(nil)
+	content.reqBlock.Meta = NewMetadata(blockZipMetaKey, "zstd", binZipMetaKey, "gzip")
+	content.acceptCompression()
+	require.Nil(t, content.blockZip)
+	require.Equal(t, GzipCompressor, content.binZip)
+
+	RegisterCompressor(testCompressor{})
+	require.Equal(t, testCompressor{}, compressorByName("test"))
+
+	header := &Header{}
+	content = CreateContent(nil)
+	content.blockZip = testCompressor{}
+	content.zipMin = 0
+	block, err := content.zipBlock(header, []byte("hello"))
+	require.NoError(t, err)
+	require.Equal(t, byte(15), header.blockZipId())
+	block, err = unzipBlock(header, block, DefaultMaxBlockSize)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), block)
+}
+
+// testCompressor stores the data as is.
+type testCompressor struct{}
+
+func (compressor testCompressor) Id() byte {
+	return 15
+}
+
+func (compressor testCompressor) Name() string {
+	return "test"
+}
+
+func (compressor testCompressor) NewWriter(writer io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{writer}, nil
+}
+
+func (compressor testCompressor) NewReader(reader io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(reader), nil
+}
+
+func TestUnzipBlockLimit(t *testing.T) {
+	content := &Content{blockZip: GzipCompressor}
+	header := NewEmptyHeader()
+	block, err := content.zipBlock(header, make([]byte, 1024*1024))
+	require.NoError(t, err)
+	require.Less(t, len(block), 10*1024)
+
+	_, err = unzipBlock(header, block, DefaultMaxBlockSize)
+	require.NoError(t, err)
+	_, err = unzipBlock(header, block, 1024)
+	require.ErrorIs(t, err, ErrBlockTooLarge)
+
+	// A block header is checked before the block is allocated.
+	_, err = readBlock(bytes.NewReader(nil), 1<<40, DefaultMaxBlockSize)
+	require.ErrorIs(t, err, ErrBlockTooLarge)
+	_, err = readBlock(bytes.NewReader(nil), -1, DefaultMaxBlockSize)
+	require.ErrorIs(t, err, ErrBlockTooLarge)
+
+	// The server refuses the block before the call is routed, as sent and
+	// as decompressed.
+	serv := NewService()
+	serv.Handler(zipEchoMethod, zipEchoHandler)
+	serv.SetMaxBlockSize(1024)
+	address := startService(t, serv)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	params := &zipSizes{Message: strings.Repeat("a", 64*1024)}
+	err = Exec(ctx, address, zipEchoMethod, params, &zipSizes{}, nil,
+		WithCompression(GzipCompressor))
+	require.EqualError(t, err, ErrBlockTooLarge.Error())
+	err = Exec(ctx, address, zipEchoMethod, params, &zipSizes{}, nil)
+	require.Error(t, err)
+
+	// The client refuses a large response block.
+	serv = NewService()
+	serv.Handler(zipEchoMethod, zipEchoHandler)
+	address = startService(t, serv)
+	err = Exec(ctx, address, zipEchoMethod, params, &zipSizes{}, nil)
+	require.NoError(t, err)
+	err = Exec(ctx, address, zipEchoMethod, params, &zipSizes{}, nil,
+		WithMaxBlockSize(1024))
+	require.ErrorIs(t, err, ErrBlockTooLarge)
+}
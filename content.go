@@ -5,14 +5,19 @@
 package dsrpc
 
 import (
+	"context"
+	"hash"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Content struct {
 	start      time.Time
 	remoteHost string
+	conn       net.Conn
 
 	sockReader io.Reader
 	sockWriter io.Writer
@@ -20,6 +25,7 @@ type Content struct {
 	reqPacket *Packet
 	reqHeader *Header
 	reqBlock  *Request
+	reqParams rawValue
 
 	resPacket *Packet
 	resHeader *Header
@@ -27,11 +33,54 @@ type Content struct {
 
 	binReader io.Reader
 	binWriter io.Writer
+	binInput  io.Reader
+	binOutput io.WriteCloser
+
+	attachIndex int
+	attachInput io.Reader
+	stream      *Stream
+	inBatch     bool
+	inCallback  bool
+	callbacks   *Service
+	callMutex   sync.Mutex
+	replies     chan *Packet
+	resRange    *Range
+
+	resSent     bool
+	trailerSent bool
+	strict      bool
+	codec       Codec
+
+	metaHeader  *Metadata
+	metaTrailer *Metadata
+
+	digestAlgo  string
+	digestOut   *Digest
+	reqHash     hash.Hash
+	resHash     hash.Hash
+	reqDigest   Digest
+	resDigest   Digest
+	autoTrailer bool
+
+	blockZip   Compressor
+	binZip     Compressor
+	zipMin     int64
+	blockMax   int64
+	reqRpcRaw  int64
+	resRpcRaw  int64
+	reqBinWire int64
+	resBinWire int64
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	watch     bool
+	inputDone atomic.Bool
 }
 
 func CreateContent(conn net.Conn) *Content {
 	context := &Content{
 		start:      time.Now(),
+		conn:       conn,
 		sockReader: conn,
 		sockWriter: conn,
 
@@ -42,6 +91,10 @@ func CreateContent(conn net.Conn) *Content {
 		resPacket: NewEmptyPacket(),
 		resHeader: NewEmptyHeader(),
 		resBlock:  NewEmptyResponse(),
+
+		codec:    JsonCodec,
+		zipMin:   DefaultCompressThreshold,
+		blockMax: DefaultMaxBlockSize,
 	}
 	return context
 }
@@ -58,6 +111,16 @@ func (context *Content) Start() time.Time {
 	return context.start
 }
 
+// ResultSent reports whether a result or an error has already been sent.
+func (context *Content) ResultSent() bool {
+	return context.resSent
+}
+
+// Codec returns the codec of the request and response blocks.
+func (context *Content) Codec() Codec {
+	return context.codec
+}
+
 func (context *Content) Method() string {
 	var method string
 	if context.reqBlock != nil {
@@ -66,14 +129,13 @@ func (context *Content) Method() string {
 	return method
 }
 
+// ReqRpcSize returns the size of the request block, uncompressed.
 func (context *Content) ReqRpcSize() int64 {
-	var size int64
-	if context.reqHeader != nil {
-		size = context.reqHeader.rpcSize
-	}
-	return size
+	return context.reqRpcRaw
 }
 
+// ReqBinSize returns the size of the request binary data, uncompressed,
+// or ChunkedSize.
 func (context *Content) ReqBinSize() int64 {
 	var size int64
 	if context.reqHeader != nil {
@@ -82,6 +144,8 @@ func (context *Content) ReqBinSize() int64 {
 	return size
 }
 
+// ResBinSize returns the size of the response binary data, uncompressed,
+// or ChunkedSize.
 func (context *Content) ResBinSize() int64 {
 	var size int64
 	if context.resHeader != nil {
@@ -90,32 +154,63 @@ func (context *Content) ResBinSize() int64 {
 	return size
 }
 
+// ResRpcSize returns the size of the response block, uncompressed.
 func (context *Content) ResRpcSize() int64 {
+	return context.resRpcRaw
+}
+
+func (context *Content) ReqSize() int64 {
+	var size int64
+	if context.reqHeader != nil {
+		if context.reqHeader.binSize > 0 {
+			size += context.reqHeader.binSize
+		}
+		size += context.reqRpcRaw
+	}
+	return size
+}
+
+func (context *Content) ResSize() int64 {
 	var size int64
 	if context.resHeader != nil {
-		size = context.resHeader.rpcSize
+		if context.resHeader.binSize > 0 {
+			size += context.resHeader.binSize
+		}
+		size += context.resRpcRaw
 	}
 	return size
 }
 
-func (context *Content) ReqSize() int64 {
+// ReqRpcWireSize returns the size of the request block on the wire.
+func (context *Content) ReqRpcWireSize() int64 {
 	var size int64
 	if context.reqHeader != nil {
-		size += context.reqHeader.binSize
-		size += context.reqHeader.rpcSize
+		size = context.reqHeader.rpcSize
 	}
 	return size
 }
 
-func (context *Content) ResSize() int64 {
+// ResRpcWireSize returns the size of the response block on the wire.
+func (context *Content) ResRpcWireSize() int64 {
 	var size int64
 	if context.resHeader != nil {
-		size += context.resHeader.binSize
-		size += context.resHeader.rpcSize
+		size = context.resHeader.rpcSize
 	}
 	return size
 }
 
+// ReqBinWireSize returns the size of the request binary data read from
+// the wire so far.
+func (context *Content) ReqBinWireSize() int64 {
+	return context.reqBinWire
+}
+
+// ResBinWireSize returns the size of the response binary data written to
+// the wire so far.
+func (context *Content) ResBinWireSize() int64 {
+	return context.resBinWire
+}
+
 func (context *Content) SetAuthIdent(ident []byte) {
 	context.reqBlock.Auth.Ident = ident
 }
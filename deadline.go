@@ -0,0 +1,85 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// timeoutMetaKey carries the time budget of the caller.
+const timeoutMetaKey = ReservedMetaPrefix + "timeout"
+
+// Context returns the context of the request. On the server it is done
+// when the deadline of the caller expires, when the client disconnects
+// or when the handler returns.
+func (content *Content) Context() context.Context {
+	if content.ctx == nil {
+		return context.Background()
+	}
+	return content.ctx
+}
+
+// setDeadline puts the remaining time of ctx into the request metadata.
+func (content *Content) setDeadline(ctx context.Context) error {
+	var err error
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return err
+	}
+	timeout := time.Until(deadline)
+	if timeout <= 0 {
+		err = context.DeadlineExceeded
+		return err
+	}
+	if content.reqBlock.Meta == nil {
+		content.reqBlock.Meta = make(Metadata)
+	}
+	content.reqBlock.Meta.Set(timeoutMetaKey, timeout.String())
+	return err
+}
+
+// setContext creates the request context with the deadline of the
+// caller, counted from the start of the request.
+func (content *Content) setContext(parent context.Context) error {
+	var err error
+	value := content.reqBlock.Meta.Get(timeoutMetaKey)
+	if len(value) == 0 {
+		content.ctx, content.cancel = context.WithCancel(parent)
+		return err
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		content.ctx, content.cancel = context.WithCancel(parent)
+		err = fmt.Errorf("invalid timeout: %s", err)
+		return err
+	}
+	content.ctx, content.cancel = context.WithDeadline(parent, content.start.Add(timeout))
+	return err
+}
+
+// closeContext releases the request context.
+func (content *Content) closeContext() {
+	if content.cancel != nil {
+		content.cancel()
+	}
+}
+
+// joinContext returns a context which is done when ctx or other is done.
+func joinContext(ctx, other context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if other.Done() == nil {
+		return ctx, cancel
+	}
+	go func() {
+		select {
+		case <-other.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const waitMethod string = "wait"
+
+func TestDeadlinePropagation(t *testing.T) {
+	done := make(chan error, 1)
+	waitHandler := func(content *Content) error {
+		ctx := content.Context()
+		_, ok := ctx.Deadline()
+		if content.Metadata().Get("mode") == "deadline" && !ok {
+			done <- errors.New("no deadline")
+			return content.SendResult(NewEmptyResult(), 0)
+		}
+		select {
+		case <-ctx.Done():
+			done <- ctx.Err()
+		case <-time.After(5 * time.Second):
+			done <- errors.New("context is not done")
+		}
+		return ctx.Err()
+	}
+	serv := NewService()
+	serv.Handler(waitMethod, waitHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	err := Exec(ctx, address, waitMethod, nil, nil, nil,
+		WithMetadata(NewMetadata("mode", "deadline")))
+	cancel()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	// The deadline on the server may fire after the client disconnects.
+	err = <-done
+	require.True(t, errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled), err)
+
+	// The client gives up without a deadline, the server sees the
+	// disconnect.
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	err = Exec(ctx, address, waitMethod, nil, nil, nil)
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestDeadlineLocalExec(t *testing.T) {
+	handler := func(content *Content) error {
+		deadline, ok := content.Context().Deadline()
+		if !ok || time.Until(deadline) > time.Minute {
+			return content.SendError(errors.New("wrong deadline"))
+		}
+		return content.SendResult(NewEmptyResult(), 0)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err := LocalGet(ctx, waitMethod, io.Discard, nil, nil, nil, handler)
+	require.NoError(t, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	err = LocalGet(ctx, waitMethod, io.Discard, nil, nil, nil, handler)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"sort"
+)
+
+// DescribeMethod is the name of the built-in introspection method
+// enabled by Service.EnableDescribe.
+const DescribeMethod string = "rpc.describe"
+
+// MethodInfo describes a registered method.
+type MethodInfo struct {
+	Name        string  `json:"name"                   msgpack:"name"`
+	Description string  `json:"description,omitempty"  msgpack:"description"`
+	Params      *Schema `json:"params,omitempty"       msgpack:"params"`
+	Result      *Schema `json:"result,omitempty"       msgpack:"result"`
+	BinaryIn    bool    `json:"binaryIn,omitempty"     msgpack:"binaryIn"`
+	BinaryOut   bool    `json:"binaryOut,omitempty"    msgpack:"binaryOut"`
+}
+
+// MethodOption sets a part of the method description at registration.
+type MethodOption func(info *MethodInfo)
+
+func WithDescription(description string) MethodOption {
+	return func(info *MethodInfo) {
+		info.Description = description
+	}
+}
+
+// WithParams sets the params schema from a sample params value.
+func WithParams(params any) MethodOption {
+	return func(info *MethodInfo) {
+		info.Params = SchemaOf(params)
+	}
+}
+
+// WithResult sets the result schema from a sample result value.
+func WithResult(result any) MethodOption {
+	return func(info *MethodInfo) {
+		info.Result = SchemaOf(result)
+	}
+}
+
+// WithBinaryIn marks the method as accepting a binary upload.
+func WithBinaryIn() MethodOption {
+	return func(info *MethodInfo) {
+		info.BinaryIn = true
+	}
+}
+
+// WithBinaryOut marks the method as producing a binary download.
+func WithBinaryOut() MethodOption {
+	return func(info *MethodInfo) {
+		info.BinaryOut = true
+	}
+}
+
+type DescribeParams struct{}
+
+type DescribeResult struct {
+	Methods []MethodInfo `json:"methods"  msgpack:"methods"`
+}
+
+// Methods returns the descriptions of the registered methods sorted by
+// name.
+func (svc *Service) Methods() []MethodInfo {
+	methods := make([]MethodInfo, 0, len(svc.infos))
+	for _, info := range svc.infos {
+		methods = append(methods, *info)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Name < methods[j].Name
+	})
+	return methods
+}
+
+// EnableDescribe registers the DescribeMethod which lists the registered
+// methods to clients.
+func (svc *Service) EnableDescribe() {
+	handler := func(content *Content) error {
+		var err error
+		params := &DescribeParams{}
+		err = content.BindParams(params)
+		if err != nil {
+			content.SendError(err)
+			return err
+		}
+		result := &DescribeResult{
+			Methods: svc.Methods(),
+		}
+		return content.SendResult(result, 0)
+	}
+	svc.Handler(DescribeMethod, handler,
+		WithDescription("List the registered methods"),
+		WithParams(DescribeParams{}),
+		WithResult(DescribeResult{}))
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type describeParams struct {
+	Name    string           `json:"name"`
+	Tags    []string         `json:"tags,omitempty"`
+	Data    []byte           `json:"data"`
+	Labels  map[string]int64 `json:"labels"`
+	Created time.Time        `json:"created"`
+	Next    *describeParams  `json:"next"`
+	Skip    string           `json:"-"`
+	hidden  string
+}
+
+func TestSchemaOf(t *testing.T) {
+	schema := SchemaOf(&describeParams{})
+	require.Equal(t, "object", schema.Type)
+	require.Len(t, schema.Properties, 6)
+	require.Equal(t, "string", schema.Properties["name"].Type)
+	require.Equal(t, "array", schema.Properties["tags"].Type)
+	require.Equal(t, "string", schema.Properties["tags"].Items.Type)
+	require.Equal(t, "base64", schema.Properties["data"].ContentEncoding)
+	require.Equal(t, "integer", schema.Properties["labels"].AdditionalProperties.Type)
+	require.Equal(t, "date-time", schema.Properties["created"].Format)
+	require.Equal(t, "object", schema.Properties["next"].Type)
+	require.Nil(t, schema.Properties["next"].Properties)
+}
+
+func TestServiceDescribe(t *testing.T) {
+	serv := NewService()
+	typedHello.Handler(serv, typedHelloHandler, WithDescription("Greet the caller"))
+	serv.Handler(LoadMethod, loadHandler, WithBinaryOut())
+	serv.EnableDescribe()
+
+	methods := serv.Methods()
+	require.Len(t, methods, 3)
+	require.Equal(t, LoadMethod, methods[0].Name)
+	require.True(t, methods[0].BinaryOut)
+	require.Equal(t, DescribeMethod, methods[1].Name)
+	require.Equal(t, "typed.hello", methods[2].Name)
+	require.Equal(t, "Greet the caller", methods[2].Description)
+	require.Equal(t, "string", methods[2].Params.Properties["message"].Type)
+
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := &DescribeResult{}
+	err := Exec(ctx, address, DescribeMethod, &DescribeParams{}, result, nil)
+	require.NoError(t, err)
+	require.Equal(t, methods, result.Methods)
+}
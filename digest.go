@@ -0,0 +1,264 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Digest algorithms of binary data.
+const (
+	DigestCRC32C = "crc32c"
+	DigestSHA256 = "sha256"
+)
+
+// digestMetaKey carries the digest algorithm in the request metadata and
+// the digest value in the trailer metadata.
+const digestMetaKey = ReservedMetaPrefix + "digest"
+
+var ErrDigestMismatch = errors.New("binary data digest mismatch")
+
+// ErrDigestMissing is returned when the response binary data comes
+// without the digest the call asked for.
+var ErrDigestMissing = errors.New("binary data digest missing")
+
+// Digest is the digest of the binary data of a call.
+type Digest struct {
+	Algo string
+	Sum  []byte
+}
+
+func (digest Digest) String() string {
+	if len(digest.Algo) == 0 {
+		return ""
+	}
+	return digest.Algo + ":" + hex.EncodeToString(digest.Sum)
+}
+
+func newDigest(algo string) (hash.Hash, error) {
+	var err error
+	switch algo {
+	case DigestCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), err
+	case DigestSHA256:
+		return sha256.New(), err
+	}
+	err = fmt.Errorf("unsupported digest %s", algo)
+	return nil, err
+}
+
+// WithDigest makes both sides compute the digest of the binary data of
+// the call with the algorithm. The sender sends the digest in a trailer
+// and the receiver fails the call with ErrDigestMismatch if the data
+// differs. The digest is stored into digest, which can be nil. A response
+// with binary data but without the digest fails with ErrDigestMissing.
+func WithDigest(algo string, digest *Digest) CallOption {
+	return func(content *Content) {
+		content.digestAlgo = algo
+		content.digestOut = digest
+	}
+}
+
+// requestDigest sets up the digest of the call on the client.
+func (content *Content) requestDigest() error {
+	var err error
+	if len(content.digestAlgo) == 0 {
+		return err
+	}
+	content.resHash, err = newDigest(content.digestAlgo)
+	if err != nil {
+		return err
+	}
+	if content.reqBlock.Meta == nil {
+		content.reqBlock.Meta = make(Metadata)
+	}
+	content.reqBlock.Meta.Set(digestMetaKey, content.digestAlgo)
+	if content.reqHeader.binSize != 0 {
+		content.reqHash, _ = newDigest(content.digestAlgo)
+		content.reqHeader.setFlag(flagTrailer)
+	}
+	return err
+}
+
+// acceptDigest sets up the digest requested by the client on the server.
+func (content *Content) acceptDigest() error {
+	var err error
+	algo := content.reqBlock.Meta.Get(digestMetaKey)
+	if len(algo) == 0 {
+		return err
+	}
+	content.digestAlgo = algo
+	content.resHash, err = newDigest(algo)
+	if err != nil {
+		return err
+	}
+	if content.reqHeader.hasFlag(flagTrailer) {
+		content.reqHash, _ = newDigest(algo)
+	}
+	return err
+}
+
+// ReqDigest returns the digest of the request binary data. It is set
+// once the data is read and verified.
+func (content *Content) ReqDigest() Digest {
+	return content.reqDigest
+}
+
+// ResDigest returns the digest of the response binary data. It is set
+// once the trailer with the digest is sent.
+func (content *Content) ResDigest() Digest {
+	return content.resDigest
+}
+
+func (content *Content) setDigestOut(digest Digest) {
+	if content.digestOut != nil {
+		*content.digestOut = digest
+	}
+}
+
+// hashWriter passes the data to the writer and to the hash.
+type hashWriter struct {
+	writer io.Writer
+	hash   hash.Hash
+}
+
+func (writer *hashWriter) Write(data []byte) (int, error) {
+	written, err := writer.writer.Write(data)
+	writer.hash.Write(data[0:written])
+	return written, err
+}
+
+func (writer *hashWriter) Close() error {
+	var err error
+	closer, ok := writer.writer.(io.Closer)
+	if ok {
+		err = closer.Close()
+	}
+	return err
+}
+
+// trailerReader reads the request binary data followed by a trailer
+// frame. The trailer is read and the digest is verified together with
+// the last bytes of the data, so a reader which stops at the data size
+// checks it too.
+type trailerReader struct {
+	content *Content
+	reader  io.Reader
+	remains int64
+	done    bool
+}
+
+func (reader *trailerReader) Read(buffer []byte) (int, error) {
+	if reader.done {
+		return 0, io.EOF
+	}
+	if reader.remains >= 0 && int64(len(buffer)) > reader.remains {
+		buffer = buffer[0:reader.remains]
+	}
+	read, err := reader.reader.Read(buffer)
+	if reader.content.reqHash != nil {
+		reader.content.reqHash.Write(buffer[0:read])
+	}
+	end := false
+	if reader.remains >= 0 {
+		reader.remains -= int64(read)
+		end = reader.remains == 0
+	} else {
+		end = err == io.EOF
+	}
+	if !end {
+		return read, err
+	}
+	reader.done = true
+	tailErr := reader.content.readReqTrailer()
+	if tailErr != nil {
+		return read, tailErr
+	}
+	return read, err
+}
+
+// readReqTrailer reads the trailer of the request binary data and
+// verifies the digest.
+func (content *Content) readReqTrailer() error {
+	var err error
+	block := &Response{
+		Result: NewEmptyResult(),
+	}
+	err = readTrailerFrame(content.sockReader, block, content.blockMax)
+	if err != nil {
+		return err
+	}
+	if content.reqHash == nil {
+		return err
+	}
+	sum := content.reqHash.Sum(nil)
+	if block.Trailer.Get(digestMetaKey) != hex.EncodeToString(sum) {
+		err = ErrDigestMismatch
+		return err
+	}
+	content.reqDigest = Digest{Algo: content.digestAlgo, Sum: sum}
+	return err
+}
+
+// writeReqTrailer writes the trailer with the digest after the request
+// binary data.
+func (content *Content) writeReqTrailer() error {
+	var err error
+	if !content.reqHeader.hasFlag(flagTrailer) {
+		return err
+	}
+	block := &Response{
+		Result:  NewEmptyResult(),
+		Trailer: make(Metadata),
+	}
+	if content.reqHash != nil {
+		sum := content.reqHash.Sum(nil)
+		block.Trailer.Set(digestMetaKey, hex.EncodeToString(sum))
+		content.setDigestOut(Digest{Algo: content.digestAlgo, Sum: sum})
+	}
+	return writeTrailerFrame(content.sockWriter, content.codec, block)
+}
+
+// resDigestTrailer returns the trailer metadata with the digest of the
+// response binary data.
+func (content *Content) resDigestTrailer(trailer Metadata) Metadata {
+	if content.resHash == nil || content.resHeader.binSize == 0 {
+		return trailer
+	}
+	sum := content.resHash.Sum(nil)
+	content.resDigest = Digest{Algo: content.digestAlgo, Sum: sum}
+	trailer = trailer.Clone()
+	if trailer == nil {
+		trailer = make(Metadata)
+	}
+	trailer.Set(digestMetaKey, hex.EncodeToString(sum))
+	return trailer
+}
+
+// verifyResDigest checks the digest of the response binary data against
+// the digest from the trailer.
+func (content *Content) verifyResDigest(value string) error {
+	var err error
+	if content.resHash == nil || content.resHeader.binSize == 0 {
+		return err
+	}
+	if len(value) == 0 {
+		err = ErrDigestMissing
+		return err
+	}
+	sum := content.resHash.Sum(nil)
+	if value != hex.EncodeToString(sum) {
+		err = ErrDigestMismatch
+		return err
+	}
+	content.setDigestOut(Digest{Algo: content.digestAlgo, Sum: sum})
+	return err
+}
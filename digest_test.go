@@ -0,0 +1,169 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	digestPutMethod  string = "digestPut"
+	digestGetMethod  string = "digestGet"
+	corruptGetMethod string = "corruptGet"
+	plainGetMethod   string = "plainGet"
+)
+
+var digestData = bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+func digestPutHandler(content *Content) error {
+	var err error
+	err = content.ReadBin(content.Context(), io.Discard)
+	if err != nil {
+		return err
+	}
+	result := &HelloResult{Message: content.ReqDigest().String()}
+	return content.SendResult(result, 0)
+}
+
+func digestGetHandler(content *Content) error {
+	var err error
+	chunked := content.Metadata().Get("chunked") == "yes"
+	if chunked {
+		writer, err := content.SendResultChunked(NewEmptyResult())
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(digestData)
+		return err
+	}
+	err = content.SendResult(NewEmptyResult(), int64(len(digestData)))
+	if err != nil {
+		return err
+	}
+	_, err = content.BinWriter().Write(digestData)
+	return err
+}
+
+// corruptGetHandler sends data which differs from the hashed data.
+func corruptGetHandler(content *Content) error {
+	var err error
+	err = content.SendResult(NewEmptyResult(), 3)
+	if err != nil {
+		return err
+	}
+	content.resHash.Write([]byte("abc"))
+	content.binOutput = newChunkWriter(content.sockWriter)
+	_, err = content.binOutput.Write([]byte("abd"))
+	return err
+}
+
+// plainGetHandler sends the data without the digest, as a server without
+// digest support.
+func plainGetHandler(content *Content) error {
+	var err error
+	content.resHash = nil
+	trailer := content.Metadata().Get("trailer") == "yes"
+	if trailer {
+		content.EnableTrailer()
+	}
+	err = content.SendResult(NewEmptyResult(), int64(len(digestData)))
+	if err != nil {
+		return err
+	}
+	_, err = content.BinWriter().Write(digestData)
+	if err != nil || !trailer {
+		return err
+	}
+	return content.SendTrailer(NewEmptyResult(), nil)
+}
+
+func TestDigest(t *testing.T) {
+	serv := NewService()
+	serv.Handler(digestPutMethod, digestPutHandler)
+	serv.Handler(digestGetMethod, digestGetHandler)
+	serv.Handler(corruptGetMethod, corruptGetHandler)
+	serv.Handler(plainGetMethod, plainGetHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sha := sha256.Sum256(digestData)
+	crc := crc32.Checksum(digestData, crc32.MakeTable(crc32.Castagnoli))
+
+	result := &HelloResult{}
+	digest := Digest{}
+	reader := bytes.NewReader(digestData)
+	err := Put(ctx, address, digestPutMethod, reader, int64(len(digestData)), nil, result, nil,
+		WithDigest(DigestSHA256, &digest))
+	require.NoError(t, err)
+	require.Equal(t, sha[:], digest.Sum)
+	require.Equal(t, "sha256:"+hex.EncodeToString(sha[:]), result.Message)
+
+	reader = bytes.NewReader(digestData)
+	err = PutStream(ctx, address, digestPutMethod, reader, nil, result, nil,
+		WithDigest(DigestCRC32C, nil))
+	require.NoError(t, err)
+	require.Equal(t, "crc32c:"+hex.EncodeToString(EncoderI64(int64(crc))[4:]), result.Message)
+
+	for _, chunked := range []string{"no", "yes"} {
+		writer := bytes.NewBuffer(nil)
+		digest = Digest{}
+		err = Get(ctx, address, digestGetMethod, writer, nil, nil, nil,
+			WithDigest(DigestSHA256, &digest), WithMetadata(NewMetadata("chunked", chunked)))
+		require.NoError(t, err, chunked)
+		require.Equal(t, digestData, writer.Bytes(), chunked)
+		require.Equal(t, sha[:], digest.Sum, chunked)
+	}
+
+	err = Get(ctx, address, corruptGetMethod, io.Discard, nil, nil, nil,
+		WithDigest(DigestCRC32C, nil))
+	require.ErrorIs(t, err, ErrDigestMismatch)
+
+	for _, trailer := range []string{"no", "yes"} {
+		err = Get(ctx, address, plainGetMethod, io.Discard, nil, nil, nil,
+			WithDigest(DigestSHA256, nil), WithMetadata(NewMetadata("trailer", trailer)))
+		require.ErrorIs(t, err, ErrDigestMissing, trailer)
+	}
+	err = Get(ctx, address, plainGetMethod, io.Discard, nil, nil, nil)
+	require.NoError(t, err)
+
+	err = Get(ctx, address, digestGetMethod, io.Discard, nil, nil, nil,
+		WithDigest("md4", nil))
+	require.Error(t, err)
+}
+
+func TestDigestUploadMismatch(t *testing.T) {
+	// The request data is followed by a trailer with a wrong digest.
+	stream := bytes.NewBuffer([]byte("hello"))
+	block := &Response{
+		Result:  NewEmptyResult(),
+		Trailer: NewMetadata(digestMetaKey, "00000000"),
+	}
+	err := writeTrailerFrame(stream, JsonCodec, block)
+	require.NoError(t, err)
+
+	conn, _ := NewFConn()
+	content := CreateContent(conn)
+	content.sockReader = stream
+	content.reqHeader.binSize = 5
+	content.reqHeader.setFlag(flagTrailer)
+	content.reqBlock.Meta = NewMetadata(digestMetaKey, DigestCRC32C)
+	err = content.acceptDigest()
+	require.NoError(t, err)
+
+	writer := bytes.NewBuffer(nil)
+	err = content.ReadBin(context.Background(), writer)
+	require.ErrorIs(t, err, ErrDigestMismatch)
+}
@@ -6,7 +6,17 @@
 
 package api
 
-const HelloMethod string = "hello"
+import (
+    "context"
+)
+
+//go:generate go run github.com/kindsoldier/dsrpc/cmd/dsrpcgen -type HelloService
+
+//dsrpc:service
+type HelloService interface {
+    //dsrpc:method hello
+    Hello(ctx context.Context, params *HelloParams) (*HelloResult, error)
+}
 
 type HelloParams struct {
     Message string      `msgpack:"message" json:"message"`
@@ -0,0 +1,58 @@
+// Code generated by dsrpcgen. DO NOT EDIT.
+
+package api
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kindsoldier/dsrpc"
+)
+
+// Method descriptors of HelloService.
+var (
+	HelloServiceHello = dsrpc.Method[HelloParams, HelloResult]("hello")
+)
+
+// HelloServiceClient calls HelloService methods on a remote service.
+type HelloServiceClient struct {
+	Address string
+	Auth    *dsrpc.Auth
+	Options []dsrpc.CallOption
+}
+
+func NewHelloServiceClient(address string, auth *dsrpc.Auth) *HelloServiceClient {
+	return &HelloServiceClient{
+		Address: address,
+		Auth:    auth,
+	}
+}
+
+var _ HelloService = (*HelloServiceClient)(nil)
+
+func (client *HelloServiceClient) Hello(ctx context.Context, params *HelloParams) (*HelloResult, error) {
+	return HelloServiceHello.Exec(ctx, client.Address, params, client.Auth, client.Options...)
+}
+
+// RegisterHelloService registers the handlers of HelloService methods served
+// by impl.
+func RegisterHelloService(svc *dsrpc.Service, impl HelloService) {
+	HelloServiceHello.Handler(svc, func(content *dsrpc.Content, params *HelloParams) (*HelloResult, error) {
+		return impl.Hello(content.Context(), params)
+	})
+}
+
+// HelloServiceMock implements HelloService with replaceable functions. Methods
+// without a function return an error.
+type HelloServiceMock struct {
+	HelloFunc func(ctx context.Context, params *HelloParams) (*HelloResult, error)
+}
+
+var _ HelloService = (*HelloServiceMock)(nil)
+
+func (mock *HelloServiceMock) Hello(ctx context.Context, params *HelloParams) (*HelloResult, error) {
+	if mock.HelloFunc == nil {
+		return nil, errors.New("HelloServiceMock.Hello is not implemented")
+	}
+	return mock.HelloFunc(ctx, params)
+}
@@ -11,8 +11,6 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/kindsoldier/dsrpc"
-
 	"netsrv/api"
 )
 
@@ -31,12 +29,11 @@ func exec() error {
 		Message: "hello, server!",
 	}
 
-	result := api.HelloResult{}
-
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(5*time.Second))
 	defer cancel()
 
-	err = dsrpc.Exec(ctx, "127.0.0.1:8081", api.HelloMethod, &params, &result, nil)
+	client := api.NewHelloServiceClient("127.0.0.1:8081", nil)
+	result, err := client.Hello(ctx, &params)
 	if err != nil {
 		return err
 	}
@@ -3,3 +3,5 @@ module netsrv
 go 1.19
 
 require github.com/kindsoldier/dsrpc v1.2.1
+
+replace github.com/kindsoldier/dsrpc => ../
@@ -7,6 +7,7 @@
 package main
 
 import (
+    "context"
     "log"
     "netsrv/api"
 
@@ -26,7 +27,7 @@ func server() error {
     serv := dsrpc.NewService()
 
     cont := NewController()
-    serv.Handler(api.HelloMethod, cont.HelloHandler)
+    api.RegisterHelloService(serv, cont)
 
     serv.PreMiddleware(dsrpc.LogRequest)
     serv.PostMiddleware(dsrpc.LogResponse)
@@ -47,22 +48,11 @@ func NewController() *Controller {
     return &Controller{}
 }
 
-func (cont *Controller) HelloHandler(content *dsrpc.Content) error {
-    var err error
-    params := api.HelloParams{}
-    err = content.BindParams(&params)
-    if err != nil {
-        return err
-    }
+func (cont *Controller) Hello(ctx context.Context, params *api.HelloParams) (*api.HelloResult, error) {
     log.Println("hello message:", params.Message)
 
-    result := api.HelloResult{
+    result := &api.HelloResult{
         Message: "hello, client!",
     }
-    err = content.SendResult(&result, 0)
-    if err != nil {
-        return err
-    }
-
-    return err
+    return result, nil
 }
@@ -0,0 +1,176 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// Exchange uploads the data of reader and downloads the response binary
+// data to writer in one call. Both run at the same time, so the server
+// can stream back a transformed form of the data while it is still being
+// uploaded. The binSize can be ChunkedSize for data of unknown length.
+func Exchange(ctx context.Context, address string, method string, reader io.Reader, binSize int64, writer io.Writer, param, result any, auth *Auth, opts ...CallOption) error {
+	var err error
+
+	conn, err := dial(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return ConnExchange(ctx, conn, method, reader, binSize, writer, param, result, auth, opts...)
+}
+
+func ConnExchange(ctx context.Context, conn net.Conn, method string, reader io.Reader, binSize int64, writer io.Writer, param, result any, auth *Auth, opts ...CallOption) error {
+	var err error
+
+	content := CreateContent(conn)
+	content.applyOptions(opts)
+	content.reqBlock.Method = method
+	if param != nil {
+		content.reqBlock.Params = param
+	}
+	if auth != nil {
+		content.reqBlock.Auth = auth
+	}
+	if result != nil {
+		content.resBlock.Result = result
+	}
+
+	content.binReader = reader
+	content.binWriter = writer
+
+	content.reqHeader.binSize = binSize
+
+	err = content.createRequest(ctx)
+	if err != nil {
+		return err
+	}
+	stop := content.watchContext(ctx, conn)
+	defer stop()
+
+	err = content.writeRequest()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	var wg sync.WaitGroup
+	upErrChan := make(chan error, 1)
+	wg.Add(1)
+	go content.uploadBinAsync(ctx, conn, &wg, upErrChan)
+
+	err = content.readResponse()
+	if err == nil {
+		err = content.downloadBin(ctx)
+	}
+	wg.Wait()
+	upErr := <-upErrChan
+	if upErr != nil {
+		return contextError(ctx, upErr)
+	}
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	err = content.bindResponse()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	err = content.readTrailer()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	return err
+}
+
+// ExchangeBin reads the request binary data and writes the response
+// binary data at the same time, as an exchange call needs. The result
+// must be sent before. The input reads the request data and the output
+// writes the response data, which is closed once output returns. The
+// first error is returned. Both must return for ExchangeBin to return, so
+// a pipe between them is closed by the side that ends.
+func (content *Content) ExchangeBin(ctx context.Context, input func(reader io.Reader) error, output func(writer io.Writer) error) error {
+	var err error
+	if !content.resSent {
+		err = errors.New("result is not sent")
+		return err
+	}
+	ctx, cancel := joinContext(ctx, content.Context())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var inErr, outErr error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var reader io.Reader = &contextReader{ctx: ctx, reader: content.BinReader()}
+		if content.reqHeader.binSize >= 0 {
+			reader = io.LimitReader(reader, content.reqHeader.binSize)
+		}
+		inErr = input(reader)
+		if inErr == nil {
+			// The rest of the data is read to reach the next frame.
+			_, inErr = io.Copy(io.Discard, reader)
+		}
+		if inErr != nil {
+			cancel()
+			return
+		}
+		content.watchConn()
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		writer := content.binStream()
+		outErr = output(&contextWriter{ctx: ctx, writer: writer})
+		if outErr == nil {
+			outErr = writer.Close()
+		}
+		if outErr != nil {
+			cancel()
+		}
+	}()
+	wg.Wait()
+
+	if inErr != nil {
+		return inErr
+	}
+	return outErr
+}
+
+// contextReader breaks reading when the context is done.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (reader *contextReader) Read(buffer []byte) (int, error) {
+	err := reader.ctx.Err()
+	if err != nil {
+		return 0, fmt.Errorf("break by context: %w", err)
+	}
+	return reader.reader.Read(buffer)
+}
+
+// contextWriter breaks writing when the context is done.
+type contextWriter struct {
+	ctx    context.Context
+	writer io.Writer
+}
+
+func (writer *contextWriter) Write(data []byte) (int, error) {
+	err := writer.ctx.Err()
+	if err != nil {
+		return 0, fmt.Errorf("break by context: %w", err)
+	}
+	return writer.writer.Write(data)
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const upperMethod string = "upper"
+
+// The data is larger than the socket buffers, so the exchange works only
+// if both directions run at the same time.
+var exchangeData = bytes.Repeat([]byte("exchange data "), 1024*512)
+
+func upperHandler(content *Content) error {
+	var err error
+	if content.BinSize() == ChunkedSize {
+		_, err = content.SendResultChunked(&HelloResult{Message: "chunked"})
+	} else {
+		err = content.SendResult(&HelloResult{Message: "sized"}, content.BinSize())
+	}
+	if err != nil {
+		return err
+	}
+	pipeReader, pipeWriter := io.Pipe()
+	input := func(reader io.Reader) error {
+		_, err := io.Copy(pipeWriter, reader)
+		pipeWriter.CloseWithError(err)
+		return err
+	}
+	output := func(writer io.Writer) error {
+		// A failed output releases the input blocked on the pipe.
+		defer pipeReader.Close()
+		buffer := make([]byte, 4096)
+		for {
+			read, err := pipeReader.Read(buffer)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			_, err = writer.Write(bytes.ToUpper(buffer[0:read]))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return content.ExchangeBin(content.Context(), input, output)
+}
+
+func TestExchange(t *testing.T) {
+	serv := NewService()
+	serv.Handler(upperMethod, upperHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	upper := bytes.ToUpper(exchangeData)
+	size := int64(len(exchangeData))
+
+	writer := bytes.NewBuffer(nil)
+	result := &HelloResult{}
+	err := Exchange(ctx, address, upperMethod, bytes.NewReader(exchangeData), size, writer, nil, result, nil)
+	require.NoError(t, err)
+	require.Equal(t, "sized", result.Message)
+	require.Equal(t, upper, writer.Bytes())
+
+	writer = bytes.NewBuffer(nil)
+	digest := Digest{}
+	err = Exchange(ctx, address, upperMethod, bytes.NewReader(exchangeData), ChunkedSize, writer, nil, result, nil,
+		WithCompression(FlateCompressor), WithDigest(DigestCRC32C, &digest))
+	require.NoError(t, err)
+	require.Equal(t, "chunked", result.Message)
+	require.Equal(t, upper, writer.Bytes())
+	require.Equal(t, DigestCRC32C, digest.Algo)
+
+	// The server fails the call without reading the data.
+	writer = bytes.NewBuffer(nil)
+	err = Exchange(ctx, address, "unknown", bytes.NewReader(exchangeData), size, writer, nil, result, nil)
+	require.Error(t, err)
+
+	// The error of the data source is returned at once.
+	start := time.Now()
+	failing := io.MultiReader(bytes.NewReader(exchangeData[:100000]), iotest.ErrReader(errors.New("source failure")))
+	err = Exchange(context.Background(), address, upperMethod, failing, size, io.Discard, nil, result, nil)
+	require.ErrorContains(t, err, "source failure")
+	require.Less(t, time.Since(start), time.Second)
+
+	start = time.Now()
+	failing = io.MultiReader(bytes.NewReader(exchangeData[:100000]), iotest.ErrReader(errors.New("source failure")))
+	err = Put(context.Background(), address, upperMethod, failing, size, nil, result, nil)
+	require.ErrorContains(t, err, "source failure")
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestLocalExchange(t *testing.T) {
+	data := []byte("local exchange")
+	writer := bytes.NewBuffer(nil)
+	result := &HelloResult{}
+	err := LocalExchange(context.Background(), upperMethod, bytes.NewReader(data), int64(len(data)), writer,
+		nil, result, nil, upperHandler)
+	require.NoError(t, err)
+	require.Equal(t, "sized", result.Message)
+	require.Equal(t, []byte("LOCAL EXCHANGE"), writer.Bytes())
+
+	content := CreateContent(nil)
+	err = content.ExchangeBin(context.Background(), nil, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+)
+
+// Call is a call which runs in its own goroutine. The result is decoded
+// into Result once the call is done.
+type Call struct {
+	Method string
+	Result any
+
+	err      error
+	done     chan struct{}
+	cancel   context.CancelFunc
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+// Progress is the amount of the binary data transferred by a call.
+type Progress struct {
+	Sent     int64
+	Received int64
+}
+
+// Go starts Exec in a new goroutine and returns the call at once.
+func Go(ctx context.Context, address, method string, param, result any, auth *Auth, opts ...CallOption) *Call {
+	call, ctx := newCall(ctx, method, result)
+	go call.run(func() error {
+		return Exec(ctx, address, method, param, result, auth, opts...)
+	})
+	return call
+}
+
+// GoPut starts Put in a new goroutine and returns the call at once.
+func GoPut(ctx context.Context, address, method string, reader io.Reader, binSize int64, param, result any, auth *Auth, opts ...CallOption) *Call {
+	call, ctx := newCall(ctx, method, result)
+	reader = &progressReader{reader: reader, count: &call.sent}
+	go call.run(func() error {
+		return Put(ctx, address, method, reader, binSize, param, result, auth, opts...)
+	})
+	return call
+}
+
+// GoGet starts Get in a new goroutine and returns the call at once.
+func GoGet(ctx context.Context, address, method string, writer io.Writer, param, result any, auth *Auth, opts ...CallOption) *Call {
+	call, ctx := newCall(ctx, method, result)
+	writer = &progressWriter{writer: writer, count: &call.received}
+	go call.run(func() error {
+		return Get(ctx, address, method, writer, param, result, auth, opts...)
+	})
+	return call
+}
+
+func newCall(ctx context.Context, method string, result any) (*Call, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	call := &Call{
+		Method: method,
+		Result: result,
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	return call, ctx
+}
+
+func (call *Call) run(exec func() error) {
+	defer close(call.done)
+	defer call.cancel()
+	call.err = exec()
+}
+
+// Done returns a channel which is closed when the call is done.
+func (call *Call) Done() <-chan struct{} {
+	return call.done
+}
+
+// Wait waits for the end of the call and returns its error.
+func (call *Call) Wait() error {
+	<-call.done
+	return call.err
+}
+
+// Err returns the error of a done call, it is nil for a call in progress.
+func (call *Call) Err() error {
+	select {
+	case <-call.done:
+		return call.err
+	default:
+		return nil
+	}
+}
+
+// Cancel cancels the call, which ends with ErrCanceled.
+func (call *Call) Cancel() {
+	call.cancel()
+}
+
+// Progress returns the amount of the binary data sent and received so
+// far.
+func (call *Call) Progress() Progress {
+	return Progress{
+		Sent:     call.sent.Load(),
+		Received: call.received.Load(),
+	}
+}
+
+// WaitAll waits for the end of all calls and returns the error of the
+// first failed one.
+func WaitAll(calls ...*Call) error {
+	var err error
+	for _, call := range calls {
+		callErr := call.Wait()
+		if callErr != nil && err == nil {
+			err = callErr
+		}
+	}
+	return err
+}
+
+// WaitFirst waits for the end of n of the calls and returns them in the
+// order they are done, with or without an error. It returns the calls
+// done so far with the error of ctx if ctx is done first.
+func WaitFirst(ctx context.Context, n int, calls ...*Call) ([]*Call, error) {
+	var err error
+	if n > len(calls) {
+		n = len(calls)
+	}
+	doneCalls := make(chan *Call, len(calls))
+	for _, call := range calls {
+		go func(call *Call) {
+			<-call.done
+			doneCalls <- call
+		}(call)
+	}
+	first := make([]*Call, 0, n)
+	for len(first) < n {
+		select {
+		case call := <-doneCalls:
+			first = append(first, call)
+		case <-ctx.Done():
+			return first, ctx.Err()
+		}
+	}
+	return first, err
+}
+
+type progressReader struct {
+	reader io.Reader
+	count  *atomic.Int64
+}
+
+func (reader *progressReader) Read(buffer []byte) (int, error) {
+	n, err := reader.reader.Read(buffer)
+	reader.count.Add(int64(n))
+	return n, err
+}
+
+type progressWriter struct {
+	writer io.Writer
+	count  *atomic.Int64
+}
+
+func (writer *progressWriter) Write(buffer []byte) (int, error) {
+	n, err := writer.writer.Write(buffer)
+	writer.count.Add(int64(n))
+	return n, err
+}
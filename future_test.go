@@ -0,0 +1,79 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuture(t *testing.T) {
+	serv := NewService()
+	serv.Handler(HelloMethod, helloHandler)
+	serv.Handler(SaveMethod, saveHandler)
+	serv.Handler(LoadMethod, loadHandler)
+	serv.Handler(sleepMethod, sleepHandler)
+	typedHello.Handler(serv, typedHelloHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	calls := make([]*Call, 0)
+	for i := 0; i < 20; i++ {
+		call := Go(ctx, address, HelloMethod, &HelloParams{Message: "hello"}, &HelloResult{}, nil)
+		calls = append(calls, call)
+	}
+	require.NoError(t, WaitAll(calls...))
+	for _, call := range calls {
+		require.Equal(t, "hello, client!", call.Result.(*HelloResult).Message)
+	}
+
+	data := bytes.Repeat([]byte("data"), 100000)
+	put := GoPut(ctx, address, SaveMethod, bytes.NewReader(data), int64(len(data)),
+		&SaveParams{}, &SaveResult{}, nil)
+	buffer := bytes.NewBuffer(nil)
+	get := GoGet(ctx, address, LoadMethod, buffer, &LoadParams{}, &LoadResult{}, nil)
+	require.NoError(t, WaitAll(put, get))
+	require.Equal(t, Progress{Sent: int64(len(data))}, put.Progress())
+	require.Equal(t, Progress{Received: int64(buffer.Len())}, get.Progress())
+
+	// A canceled call ends at once.
+	slow := Go(ctx, address, sleepMethod, &SleepParams{Millis: 2000}, nil, nil)
+	require.Nil(t, slow.Err())
+	slow.Cancel()
+	select {
+	case <-slow.Done():
+	case <-time.After(time.Second):
+		t.Fatal("call is not canceled")
+	}
+	require.ErrorIs(t, slow.Wait(), context.Canceled)
+
+	// The first calls are taken without waiting for a slow one.
+	slow = Go(ctx, address, sleepMethod, &SleepParams{Millis: 2000}, nil, nil)
+	calls = []*Call{slow}
+	for i := 0; i < 3; i++ {
+		calls = append(calls, Go(ctx, address, sleepMethod, &SleepParams{Millis: 10}, nil, nil))
+	}
+	first, err := WaitFirst(ctx, 3, calls...)
+	require.NoError(t, err)
+	require.Len(t, first, 3)
+	require.NotContains(t, first, slow)
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer waitCancel()
+	first, err = WaitFirst(waitCtx, 4, calls...)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Len(t, first, 3)
+	slow.Cancel()
+
+	result, call := typedHello.Go(ctx, address, &HelloParams{Message: "async"}, nil)
+	require.NoError(t, call.Wait())
+	require.Equal(t, "re: async", result.Message)
+}
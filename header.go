@@ -18,6 +18,49 @@ const (
 	sizeOfInt64 int   = 8
 	magicCodeA  int64 = 0xEE00ABBA
 	magicCodeB  int64 = 0xEE44ABBA
+
+	magicCodeMask int64 = 0xFFFFFFFF
+	flagsShift          = 32
+)
+
+// Header flag bits. The flags share the last header word with the
+// second magic code: the magic code takes the low half and the flags the
+// high half, so a header without flags is the same as in earlier
+// releases.
+const (
+	flagCodecMask int64 = 0x0F
+	flagKindMask  int64 = 0xF0
+	flagKindShift       = 4
+	// flagTrailer marks a response followed by a trailer frame.
+	flagTrailer int64 = 0x100
+	// flagStream marks a request or a response followed by message
+	// frames.
+	flagStream int64 = 0x200
+	// flagNotify marks a request which is not answered.
+	flagNotify int64 = 0x400
+	// flagBatch marks a request which carries a batch of calls.
+	flagBatch int64 = 0x800
+	// The compressor ids of the block and of the binary data.
+	flagBlockZipMask  int64 = 0xF000
+	flagBlockZipShift       = 12
+	flagBinZipMask    int64 = 0xF0000
+	flagBinZipShift         = 16
+	// flagCallback marks a request whose client answers callbacks.
+	flagCallback int64 = 0x100000
+)
+
+// Frame kinds. A call frame carries a request or a response, control
+// frames follow the request on the same connection, a trailer frame
+// follows the binary data of the response and a message frame carries a
+// message of a stream. A callback frame carries a request of the server
+// to the client, which answers it with a reply frame.
+const (
+	frameCall     byte = 0
+	frameCancel   byte = 1
+	frameTrailer  byte = 2
+	frameMessage  byte = 3
+	frameCallback byte = 4
+	frameReply    byte = 5
 )
 
 type Header struct {
@@ -25,6 +68,7 @@ type Header struct {
 	rpcSize    int64 `json:"rpcSize"`
 	binSize    int64 `json:"binSize"`
 	magicCodeB int64 `json:"magicCodeB"`
+	flags      int64 `json:"flags"`
 }
 
 func NewEmptyHeader() *Header {
@@ -53,7 +97,7 @@ func (hdr *Header) Pack() ([]byte, error) {
 	binSizeBytes := EncoderI64(hdr.binSize)
 	headerBuffer.Write(binSizeBytes)
 
-	magicCodeBBytes := EncoderI64(hdr.magicCodeB)
+	magicCodeBBytes := EncoderI64(hdr.magicCodeB | hdr.flags<<flagsShift)
 	headerBuffer.Write(magicCodeBBytes)
 
 	return headerBuffer.Bytes(), err
@@ -76,11 +120,13 @@ func UnpackHeader(headerBytes []byte) (*Header, error) {
 	magicCodeBBytes := make([]byte, sizeOfInt64)
 	headerReader.Read(magicCodeBBytes)
 
+	magicWord := DecoderI64(magicCodeBBytes)
 	header := &Header{
 		magicCodeA: DecoderI64(magicCodeABytes),
 		rpcSize:    DecoderI64(rpcSizeBytes),
 		binSize:    DecoderI64(binSizeBytes),
-		magicCodeB: DecoderI64(magicCodeBBytes),
+		magicCodeB: magicWord & magicCodeMask,
+		flags:      int64(uint64(magicWord) >> flagsShift),
 	}
 
 	if header.magicCodeA != magicCodeA || header.magicCodeB != magicCodeB {
@@ -90,6 +136,46 @@ func UnpackHeader(headerBytes []byte) (*Header, error) {
 	return header, err
 }
 
+func (hdr *Header) codecId() byte {
+	return byte(hdr.flags & flagCodecMask)
+}
+
+func (hdr *Header) setCodecId(id byte) {
+	hdr.flags = hdr.flags&^flagCodecMask | int64(id)&flagCodecMask
+}
+
+func (hdr *Header) frameKind() byte {
+	return byte((hdr.flags & flagKindMask) >> flagKindShift)
+}
+
+func (hdr *Header) setFrameKind(kind byte) {
+	hdr.flags = hdr.flags&^flagKindMask | int64(kind)<<flagKindShift&flagKindMask
+}
+
+func (hdr *Header) blockZipId() byte {
+	return byte((hdr.flags & flagBlockZipMask) >> flagBlockZipShift)
+}
+
+func (hdr *Header) setBlockZipId(id byte) {
+	hdr.flags = hdr.flags&^flagBlockZipMask | int64(id)<<flagBlockZipShift&flagBlockZipMask
+}
+
+func (hdr *Header) binZipId() byte {
+	return byte((hdr.flags & flagBinZipMask) >> flagBinZipShift)
+}
+
+func (hdr *Header) setBinZipId(id byte) {
+	hdr.flags = hdr.flags&^flagBinZipMask | int64(id)<<flagBinZipShift&flagBinZipMask
+}
+
+func (hdr *Header) hasFlag(flag int64) bool {
+	return hdr.flags&flag != 0
+}
+
+func (hdr *Header) setFlag(flag int64) {
+	hdr.flags |= flag
+}
+
 func EncoderI64(i int64) []byte {
 	buffer := make([]byte, sizeOfInt64)
 	binary.BigEndian.PutUint64(buffer, uint64(i))
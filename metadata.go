@@ -0,0 +1,159 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Metadata carries cross-cutting values of a call, such as request ids,
+// tenant ids, locale or trace context. Keys are case-insensitive and are
+// kept in lower case.
+type Metadata map[string]string
+
+// ReservedMetaPrefix marks the metadata keys used by the framework.
+// Calls and handlers can not set such keys.
+const ReservedMetaPrefix = "dsrpc-"
+
+var ErrReservedMeta = errors.New("reserved metadata key")
+
+// NewMetadata creates metadata from key and value pairs.
+func NewMetadata(pairs ...string) Metadata {
+	md := make(Metadata, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		md.Set(pairs[i], pairs[i+1])
+	}
+	return md
+}
+
+func (md Metadata) Get(key string) string {
+	return md[strings.ToLower(key)]
+}
+
+func (md Metadata) Set(key, value string) {
+	md[strings.ToLower(key)] = value
+}
+
+func (md Metadata) Delete(key string) {
+	delete(md, strings.ToLower(key))
+}
+
+func (md Metadata) Clone() Metadata {
+	if md == nil {
+		return nil
+	}
+	clone := make(Metadata, len(md))
+	for key, value := range md {
+		clone[key] = value
+	}
+	return clone
+}
+
+// merge copies the values of src into md, creating md if needed.
+func (md Metadata) merge(src Metadata) Metadata {
+	if len(src) == 0 {
+		return md
+	}
+	if md == nil {
+		md = make(Metadata, len(src))
+	}
+	for key, value := range src {
+		md.Set(key, value)
+	}
+	return md
+}
+
+func checkMetadata(md Metadata) error {
+	var err error
+	for key := range md {
+		if len(key) == 0 {
+			err = errors.New("empty metadata key")
+			return err
+		}
+		if strings.HasPrefix(strings.ToLower(key), ReservedMetaPrefix) {
+			err = fmt.Errorf("%w: %s", ErrReservedMeta, key)
+			return err
+		}
+	}
+	return err
+}
+
+// WithMetadata adds the values to the request metadata of the call.
+func WithMetadata(md Metadata) CallOption {
+	return func(content *Content) {
+		content.reqBlock.Meta = content.reqBlock.Meta.merge(md)
+	}
+}
+
+// WithHeader stores the response header metadata of the call into header.
+func WithHeader(header *Metadata) CallOption {
+	return func(content *Content) {
+		content.metaHeader = header
+	}
+}
+
+// WithTrailer stores the response trailer metadata of the call into
+// trailer.
+func WithTrailer(trailer *Metadata) CallOption {
+	return func(content *Content) {
+		content.metaTrailer = trailer
+	}
+}
+
+// Metadata returns the request metadata.
+func (content *Content) Metadata() Metadata {
+	return content.reqBlock.Meta
+}
+
+// SetResponseMetadata adds the values to the response header metadata.
+// It must be called before the result is sent.
+func (content *Content) SetResponseMetadata(md Metadata) error {
+	var err error
+	err = content.checkResponseMeta(md)
+	if err != nil {
+		return err
+	}
+	content.resBlock.Header = content.resBlock.Header.merge(md)
+	return err
+}
+
+// SetResponseTrailer adds the values to the response trailer metadata,
+// meant for values known once the handler has done its work. It must be
+// called before the result is sent, or before the trailer frame if the
+// trailer is enabled.
+func (content *Content) SetResponseTrailer(md Metadata) error {
+	var err error
+	if content.trailerPending() {
+		err = checkMetadata(md)
+	} else {
+		err = content.checkResponseMeta(md)
+	}
+	if err != nil {
+		return err
+	}
+	content.resBlock.Trailer = content.resBlock.Trailer.merge(md)
+	return err
+}
+
+func (content *Content) checkResponseMeta(md Metadata) error {
+	var err error
+	if content.resSent {
+		err = errors.New("response already sent")
+		return err
+	}
+	return checkMetadata(md)
+}
+
+// bindMetadata hands the response metadata to the caller.
+func (content *Content) bindMetadata() {
+	if content.metaHeader != nil {
+		*content.metaHeader = content.resBlock.Header
+	}
+	if content.metaTrailer != nil {
+		*content.metaTrailer = content.resBlock.Trailer
+	}
+}
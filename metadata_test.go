@@ -0,0 +1,71 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func metaHandler(content *Content) error {
+	var err error
+	params := HelloParams{}
+	err = content.BindParams(&params)
+	if err != nil {
+		return err
+	}
+	requestId := content.Metadata().Get("X-Request-Id")
+	err = content.SetResponseMetadata(NewMetadata("x-request-id", requestId))
+	if err != nil {
+		return err
+	}
+	err = content.SetResponseMetadata(NewMetadata(ReservedMetaPrefix+"foo", "bar"))
+	if !errors.Is(err, ErrReservedMeta) {
+		return errors.New("reserved key accepted")
+	}
+	err = content.SetResponseTrailer(NewMetadata("x-count", "1"))
+	if err != nil {
+		return err
+	}
+	result := HelloResult{Message: content.Metadata().Get("locale")}
+	err = content.SendResult(result, 0)
+	if err != nil {
+		return err
+	}
+	err = content.SetResponseTrailer(NewMetadata("x-late", "1"))
+	if err == nil {
+		return errors.New("trailer set after result")
+	}
+	return nil
+}
+
+func TestMetadataLocalExec(t *testing.T) {
+	for _, codec := range []Codec{JsonCodec, GobCodec, MsgpackCodec} {
+		params := HelloParams{Message: "hello"}
+		result := HelloResult{}
+		var header, trailer Metadata
+
+		md := NewMetadata("X-Request-Id", "42")
+		err := LocalExec(HelloMethod, &params, &result, nil, metaHandler,
+			WithCodec(codec),
+			WithMetadata(md),
+			WithMetadata(NewMetadata("Locale", "en")),
+			WithHeader(&header),
+			WithTrailer(&trailer))
+		require.NoError(t, err, codec.Name())
+		require.Equal(t, "en", result.Message, codec.Name())
+		require.Equal(t, Metadata{"x-request-id": "42"}, header, codec.Name())
+		require.Equal(t, Metadata{"x-count": "1"}, trailer, codec.Name())
+	}
+}
+
+func TestMetadataReserved(t *testing.T) {
+	params := HelloParams{Message: "hello"}
+	md := NewMetadata(ReservedMetaPrefix+"timeout", "1s")
+	err := LocalExec(HelloMethod, &params, nil, nil, metaHandler, WithMetadata(md))
+	require.ErrorIs(t, err, ErrReservedMeta)
+}
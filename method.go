@@ -0,0 +1,194 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"io"
+	"net"
+)
+
+// Method is a typed method descriptor. It binds a method name to its
+// params and result types so that both the server registration and the
+// client call are checked by the compiler:
+//
+//	var Hello = dsrpc.Method[HelloParams, HelloResult]("hello")
+type Method[P, R any] string
+
+// MethodFunc is a typed handler for a Method descriptor.
+type MethodFunc[P, R any] func(content *Content, params *P) (*R, error)
+
+func (method Method[P, R]) Name() string {
+	return string(method)
+}
+
+func (method Method[P, R]) Exec(ctx context.Context, address string, params *P, auth *Auth, opts ...CallOption) (*R, error) {
+	result := new(R)
+	err := Exec(ctx, address, method.Name(), params, result, auth, opts...)
+	return result, err
+}
+
+func (method Method[P, R]) ConnExec(ctx context.Context, conn net.Conn, params *P, auth *Auth, opts ...CallOption) (*R, error) {
+	result := new(R)
+	err := ConnExec(ctx, conn, method.Name(), params, result, auth, opts...)
+	return result, err
+}
+
+func (method Method[P, R]) Put(ctx context.Context, address string, reader io.Reader, binSize int64, params *P, auth *Auth, opts ...CallOption) (*R, error) {
+	result := new(R)
+	err := Put(ctx, address, method.Name(), reader, binSize, params, result, auth, opts...)
+	return result, err
+}
+
+func (method Method[P, R]) ConnPut(ctx context.Context, conn net.Conn, reader io.Reader, binSize int64, params *P, auth *Auth, opts ...CallOption) (*R, error) {
+	result := new(R)
+	err := ConnPut(ctx, conn, method.Name(), reader, binSize, params, result, auth, opts...)
+	return result, err
+}
+
+func (method Method[P, R]) PutStream(ctx context.Context, address string, reader io.Reader, params *P, auth *Auth, opts ...CallOption) (*R, error) {
+	return method.Put(ctx, address, reader, ChunkedSize, params, auth, opts...)
+}
+
+func (method Method[P, R]) ConnPutStream(ctx context.Context, conn net.Conn, reader io.Reader, params *P, auth *Auth, opts ...CallOption) (*R, error) {
+	return method.ConnPut(ctx, conn, reader, ChunkedSize, params, auth, opts...)
+}
+
+func (method Method[P, R]) Get(ctx context.Context, address string, writer io.Writer, params *P, auth *Auth, opts ...CallOption) (*R, error) {
+	result := new(R)
+	err := Get(ctx, address, method.Name(), writer, params, result, auth, opts...)
+	return result, err
+}
+
+func (method Method[P, R]) ConnGet(ctx context.Context, conn net.Conn, writer io.Writer, params *P, auth *Auth, opts ...CallOption) (*R, error) {
+	result := new(R)
+	err := ConnGet(ctx, conn, method.Name(), writer, params, result, auth, opts...)
+	return result, err
+}
+
+func (method Method[P, R]) Exchange(ctx context.Context, address string, reader io.Reader, binSize int64, writer io.Writer, params *P, auth *Auth, opts ...CallOption) (*R, error) {
+	result := new(R)
+	err := Exchange(ctx, address, method.Name(), reader, binSize, writer, params, result, auth, opts...)
+	return result, err
+}
+
+func (method Method[P, R]) ConnExchange(ctx context.Context, conn net.Conn, reader io.Reader, binSize int64, writer io.Writer, params *P, auth *Auth, opts ...CallOption) (*R, error) {
+	result := new(R)
+	err := ConnExchange(ctx, conn, method.Name(), reader, binSize, writer, params, result, auth, opts...)
+	return result, err
+}
+
+func (method Method[P, R]) PutAttachments(ctx context.Context, address string, attachments []AttachmentReader, params *P, auth *Auth, opts ...CallOption) (*R, error) {
+	result := new(R)
+	err := PutAttachments(ctx, address, method.Name(), attachments, params, result, auth, opts...)
+	return result, err
+}
+
+func (method Method[P, R]) ConnPutAttachments(ctx context.Context, conn net.Conn, attachments []AttachmentReader, params *P, auth *Auth, opts ...CallOption) (*R, error) {
+	result := new(R)
+	err := ConnPutAttachments(ctx, conn, method.Name(), attachments, params, result, auth, opts...)
+	return result, err
+}
+
+func (method Method[P, R]) GetAttachments(ctx context.Context, address string, writers AttachmentFunc, params *P, auth *Auth, opts ...CallOption) (*R, error) {
+	result := new(R)
+	err := GetAttachments(ctx, address, method.Name(), writers, params, result, auth, opts...)
+	return result, err
+}
+
+func (method Method[P, R]) ConnGetAttachments(ctx context.Context, conn net.Conn, writers AttachmentFunc, params *P, auth *Auth, opts ...CallOption) (*R, error) {
+	result := new(R)
+	err := ConnGetAttachments(ctx, conn, method.Name(), writers, params, result, auth, opts...)
+	return result, err
+}
+
+// OpenStream calls a server-streaming method, the messages are received
+// from the returned stream.
+func (method Method[P, R]) OpenStream(ctx context.Context, address string, params *P, auth *Auth, opts ...CallOption) (*R, *Stream, error) {
+	result := new(R)
+	stream, err := OpenStream(ctx, address, method.Name(), params, result, auth, opts...)
+	return result, stream, err
+}
+
+func (method Method[P, R]) ConnOpenStream(ctx context.Context, conn net.Conn, params *P, auth *Auth, opts ...CallOption) (*R, *Stream, error) {
+	result := new(R)
+	stream, err := ConnOpenStream(ctx, conn, method.Name(), params, result, auth, opts...)
+	return result, stream, err
+}
+
+// OpenBidiStream calls a client-streaming or bidirectional method.
+func (method Method[P, R]) OpenBidiStream(ctx context.Context, address string, params *P, result *R, auth *Auth, opts ...CallOption) (*Stream, error) {
+	return OpenBidiStream(ctx, address, method.Name(), params, result, auth, opts...)
+}
+
+func (method Method[P, R]) ConnOpenBidiStream(ctx context.Context, conn net.Conn, params *P, result *R, auth *Auth, opts ...CallOption) (*Stream, error) {
+	return ConnOpenBidiStream(ctx, conn, method.Name(), params, result, auth, opts...)
+}
+
+// Notify sends a notification, which the server does not answer.
+func (method Method[P, R]) Notify(ctx context.Context, address string, params *P, auth *Auth, opts ...CallOption) error {
+	return Notify(ctx, address, method.Name(), params, auth, opts...)
+}
+
+func (method Method[P, R]) ConnNotify(ctx context.Context, conn net.Conn, params *P, auth *Auth, opts ...CallOption) error {
+	return ConnNotify(ctx, conn, method.Name(), params, auth, opts...)
+}
+
+func (method Method[P, R]) LocalExec(params *P, auth *Auth, handler MethodFunc[P, R], opts ...CallOption) (*R, error) {
+	result := new(R)
+	err := LocalExec(method.Name(), params, result, auth, method.HandlerFunc(handler), opts...)
+	return result, err
+}
+
+// BindParams decodes the request params into a new value of the
+// descriptor params type.
+func (method Method[P, R]) BindParams(content *Content) (*P, error) {
+	params := new(P)
+	err := content.BindParams(params)
+	return params, err
+}
+
+// HandlerFunc adapts a typed handler to the plain HandlerFunc. The params
+// are bound before the call and the returned result is sent with a zero
+// binary size. A handler that streams a binary sends the result itself
+// and returns a nil result.
+func (method Method[P, R]) HandlerFunc(handler MethodFunc[P, R]) HandlerFunc {
+	return func(content *Content) error {
+		var err error
+		params, err := method.BindParams(content)
+		if err != nil {
+			content.SendError(err)
+			return err
+		}
+		result, err := handler(content, params)
+		if result == nil {
+			return content.sendReturn(nil, err)
+		}
+		return content.sendReturn(result, err)
+	}
+}
+
+// Handler registers the typed handler on the service. The params and
+// result schemas are taken from the descriptor types.
+func (method Method[P, R]) Handler(svc *Service, handler MethodFunc[P, R], opts ...MethodOption) {
+	typeOpts := []MethodOption{WithParams(new(P)), WithResult(new(R))}
+	svc.Handler(method.Name(), method.HandlerFunc(handler), append(typeOpts, opts...)...)
+}
+
+// AddTo appends a call of the method to the batch and returns the result
+// which is decoded when the batch is executed.
+func (method Method[P, R]) AddTo(batch *Batch, params *P) (*R, *BatchCall) {
+	result := new(R)
+	call := batch.Add(method.Name(), params, result)
+	return result, call
+}
+
+// Go starts the call in a new goroutine and returns the result, which is
+// decoded once the call is done.
+func (method Method[P, R]) Go(ctx context.Context, address string, params *P, auth *Auth, opts ...CallOption) (*R, *Call) {
+	result := new(R)
+	call := Go(ctx, address, method.Name(), params, result, auth, opts...)
+	return result, call
+}
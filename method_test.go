@@ -0,0 +1,74 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var typedHello = Method[HelloParams, HelloResult]("typed.hello")
+var typedLoad = Method[LoadParams, LoadResult]("typed.load")
+
+func typedHelloHandler(content *Content, params *HelloParams) (*HelloResult, error) {
+	if params.Message == "" {
+		return nil, errors.New("empty message")
+	}
+	result := &HelloResult{
+		Message: "re: " + params.Message,
+	}
+	return result, nil
+}
+
+func typedLoadHandler(content *Content, params *LoadParams) (*LoadResult, error) {
+	var err error
+	binBytes := []byte(params.Message)
+	result := &LoadResult{
+		Message: "loaded",
+	}
+	err = content.SendResult(result, int64(len(binBytes)))
+	if err != nil {
+		return nil, err
+	}
+	_, err = content.BinWriter().Write(binBytes)
+	return nil, err
+}
+
+func TestMethodLocalExec(t *testing.T) {
+	params := &HelloParams{Message: "hi"}
+	result, err := typedHello.LocalExec(params, nil, typedHelloHandler)
+	require.NoError(t, err)
+	require.Equal(t, "re: hi", result.Message)
+
+	params = &HelloParams{}
+	_, err = typedHello.LocalExec(params, nil, typedHelloHandler)
+	require.Error(t, err)
+	require.Equal(t, "empty message", err.Error())
+}
+
+func TestMethodNet(t *testing.T) {
+	serv := NewService()
+	typedHello.Handler(serv, typedHelloHandler)
+	typedLoad.Handler(serv, typedLoadHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := typedHello.Exec(ctx, address, &HelloParams{Message: "hi"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "re: hi", result.Message)
+
+	writer := bytes.NewBuffer(nil)
+	loadResult, err := typedLoad.Get(ctx, address, writer, &LoadParams{Message: "payload"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "loaded", loadResult.Message)
+	require.Equal(t, "payload", writer.String())
+}
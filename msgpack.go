@@ -0,0 +1,940 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MessagePack type codes, see https://github.com/msgpack/msgpack/blob/master/spec.md
+const (
+	mpNil      byte = 0xc0
+	mpFalse    byte = 0xc2
+	mpTrue     byte = 0xc3
+	mpBin8     byte = 0xc4
+	mpBin16    byte = 0xc5
+	mpBin32    byte = 0xc6
+	mpExt8     byte = 0xc7
+	mpExt16    byte = 0xc8
+	mpExt32    byte = 0xc9
+	mpFloat32  byte = 0xca
+	mpFloat64  byte = 0xcb
+	mpUint8    byte = 0xcc
+	mpUint16   byte = 0xcd
+	mpUint32   byte = 0xce
+	mpUint64   byte = 0xcf
+	mpInt8     byte = 0xd0
+	mpInt16    byte = 0xd1
+	mpInt32    byte = 0xd2
+	mpInt64    byte = 0xd3
+	mpFixExt1  byte = 0xd4
+	mpFixExt2  byte = 0xd5
+	mpFixExt4  byte = 0xd6
+	mpFixExt8  byte = 0xd7
+	mpFixExt16 byte = 0xd8
+	mpStr8     byte = 0xd9
+	mpStr16    byte = 0xda
+	mpStr32    byte = 0xdb
+	mpArray16  byte = 0xdc
+	mpArray32  byte = 0xdd
+	mpMap16    byte = 0xde
+	mpMap32    byte = 0xdf
+
+	// The timestamp extension type is -1.
+	mpTimeExt byte = 0xff
+)
+
+var errMsgpackShort = errors.New("msgpack: unexpected end of data")
+
+var errMsgpackDepth = errors.New("msgpack: exceeded max depth")
+
+// msgpackMaxDepth limits the nesting of arrays and maps, so that deep data
+// ends with an error instead of a stack overflow.
+const msgpackMaxDepth = 10000
+
+// msgpackMaxPrealloc limits the number of slice elements and map entries
+// allocated before they are decoded.
+const msgpackMaxPrealloc = 1024
+
+var typeOfRawValue = reflect.TypeOf(rawValue{})
+
+// MarshalMsgpack encodes the value as MessagePack. Struct fields are
+// named by the msgpack tag, then by the json tag, then by the field name,
+// and the omitempty option is honoured. time.Time uses the timestamp
+// extension.
+func MarshalMsgpack(value any) ([]byte, error) {
+	enc := &msgpackEncoder{
+		buffer: make([]byte, 0, 256),
+	}
+	err := enc.encode(reflect.ValueOf(value))
+	return enc.buffer, err
+}
+
+// UnmarshalMsgpack decodes MessagePack data into the value, which must
+// be a non-nil pointer. Like encoding/json, an interface holding a
+// non-nil pointer is decoded into the pointed value.
+func UnmarshalMsgpack(data []byte, value any) error {
+	rvalue := reflect.ValueOf(value)
+	if rvalue.Kind() != reflect.Pointer || rvalue.IsNil() {
+		return errors.New("msgpack: unmarshal target is not a non-nil pointer")
+	}
+	dec := &msgpackDecoder{
+		data: data,
+	}
+	return dec.decode(rvalue.Elem())
+}
+
+type msgpackField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var msgpackFieldCache sync.Map
+
+func msgpackFields(rtype reflect.Type) []msgpackField {
+	cached, ok := msgpackFieldCache.Load(rtype)
+	if ok {
+		return cached.([]msgpackField)
+	}
+	fields := make([]msgpackField, 0)
+	for _, field := range reflect.VisibleFields(rtype) {
+		if !field.IsExported() {
+			continue
+		}
+		tag, ok := field.Tag.Lookup("msgpack")
+		if !ok {
+			tag = field.Tag.Get("json")
+		}
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, msgpackField{
+			name:      name,
+			index:     field.Index,
+			omitEmpty: strings.Contains(options, "omitempty"),
+		})
+	}
+	msgpackFieldCache.Store(rtype, fields)
+	return fields
+}
+
+type msgpackEncoder struct {
+	buffer []byte
+}
+
+func (enc *msgpackEncoder) writeByte(code byte) {
+	enc.buffer = append(enc.buffer, code)
+}
+
+func (enc *msgpackEncoder) writeUint(code byte, size int, value uint64) {
+	enc.buffer = append(enc.buffer, code)
+	for i := size - 1; i >= 0; i-- {
+		enc.buffer = append(enc.buffer, byte(value>>(8*i)))
+	}
+}
+
+func (enc *msgpackEncoder) encodeInt(value int64) {
+	switch {
+	case value >= 0:
+		enc.encodeUint(uint64(value))
+	case value >= -32:
+		enc.writeByte(byte(value))
+	case value >= math.MinInt8:
+		enc.writeUint(mpInt8, 1, uint64(value))
+	case value >= math.MinInt16:
+		enc.writeUint(mpInt16, 2, uint64(value))
+	case value >= math.MinInt32:
+		enc.writeUint(mpInt32, 4, uint64(value))
+	default:
+		enc.writeUint(mpInt64, 8, uint64(value))
+	}
+}
+
+func (enc *msgpackEncoder) encodeUint(value uint64) {
+	switch {
+	case value <= 0x7f:
+		enc.writeByte(byte(value))
+	case value <= math.MaxUint8:
+		enc.writeUint(mpUint8, 1, value)
+	case value <= math.MaxUint16:
+		enc.writeUint(mpUint16, 2, value)
+	case value <= math.MaxUint32:
+		enc.writeUint(mpUint32, 4, value)
+	default:
+		enc.writeUint(mpUint64, 8, value)
+	}
+}
+
+func (enc *msgpackEncoder) encodeString(value string) {
+	size := len(value)
+	switch {
+	case size <= 31:
+		enc.writeByte(0xa0 | byte(size))
+	case size <= math.MaxUint8:
+		enc.writeUint(mpStr8, 1, uint64(size))
+	case size <= math.MaxUint16:
+		enc.writeUint(mpStr16, 2, uint64(size))
+	default:
+		enc.writeUint(mpStr32, 4, uint64(size))
+	}
+	enc.buffer = append(enc.buffer, value...)
+}
+
+func (enc *msgpackEncoder) encodeBin(value []byte) {
+	size := len(value)
+	switch {
+	case size <= math.MaxUint8:
+		enc.writeUint(mpBin8, 1, uint64(size))
+	case size <= math.MaxUint16:
+		enc.writeUint(mpBin16, 2, uint64(size))
+	default:
+		enc.writeUint(mpBin32, 4, uint64(size))
+	}
+	enc.buffer = append(enc.buffer, value...)
+}
+
+func (enc *msgpackEncoder) encodeArrayLen(size int) {
+	switch {
+	case size <= 15:
+		enc.writeByte(0x90 | byte(size))
+	case size <= math.MaxUint16:
+		enc.writeUint(mpArray16, 2, uint64(size))
+	default:
+		enc.writeUint(mpArray32, 4, uint64(size))
+	}
+}
+
+func (enc *msgpackEncoder) encodeMapLen(size int) {
+	switch {
+	case size <= 15:
+		enc.writeByte(0x80 | byte(size))
+	case size <= math.MaxUint16:
+		enc.writeUint(mpMap16, 2, uint64(size))
+	default:
+		enc.writeUint(mpMap32, 4, uint64(size))
+	}
+}
+
+func (enc *msgpackEncoder) encodeTime(value time.Time) {
+	enc.writeUint(mpExt8, 1, 12)
+	enc.writeByte(mpTimeExt)
+	enc.buffer = binary.BigEndian.AppendUint32(enc.buffer, uint32(value.Nanosecond()))
+	enc.buffer = binary.BigEndian.AppendUint64(enc.buffer, uint64(value.Unix()))
+}
+
+func (enc *msgpackEncoder) encode(value reflect.Value) error {
+	var err error
+	if !value.IsValid() {
+		enc.writeByte(mpNil)
+		return err
+	}
+	switch value.Type() {
+	case typeOfTime:
+		enc.encodeTime(value.Interface().(time.Time))
+		return err
+	case typeOfRawValue:
+		if value.Len() == 0 {
+			enc.writeByte(mpNil)
+			return err
+		}
+		enc.buffer = append(enc.buffer, value.Bytes()...)
+		return err
+	}
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			enc.writeByte(mpNil)
+			return err
+		}
+		return enc.encode(value.Elem())
+	case reflect.Bool:
+		if value.Bool() {
+			enc.writeByte(mpTrue)
+		} else {
+			enc.writeByte(mpFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		enc.encodeInt(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		enc.encodeUint(value.Uint())
+	case reflect.Float32:
+		enc.writeUint(mpFloat32, 4, uint64(math.Float32bits(float32(value.Float()))))
+	case reflect.Float64:
+		enc.writeUint(mpFloat64, 8, math.Float64bits(value.Float()))
+	case reflect.String:
+		enc.encodeString(value.String())
+	case reflect.Slice:
+		if value.IsNil() {
+			enc.writeByte(mpNil)
+			return err
+		}
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			enc.encodeBin(value.Bytes())
+			return err
+		}
+		return enc.encodeArray(value)
+	case reflect.Array:
+		return enc.encodeArray(value)
+	case reflect.Map:
+		if value.IsNil() {
+			enc.writeByte(mpNil)
+			return err
+		}
+		enc.encodeMapLen(value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			err = enc.encode(iter.Key())
+			if err != nil {
+				return err
+			}
+			err = enc.encode(iter.Value())
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return enc.encodeStruct(value)
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", value.Type())
+	}
+	return err
+}
+
+func (enc *msgpackEncoder) encodeArray(value reflect.Value) error {
+	var err error
+	enc.encodeArrayLen(value.Len())
+	for i := 0; i < value.Len(); i++ {
+		err = enc.encode(value.Index(i))
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (enc *msgpackEncoder) encodeStruct(value reflect.Value) error {
+	var err error
+	fields := msgpackFields(value.Type())
+	values := make([]reflect.Value, len(fields))
+	count := 0
+	for i, field := range fields {
+		fieldValue, ferr := value.FieldByIndexErr(field.index)
+		if ferr != nil {
+			continue
+		}
+		if field.omitEmpty && fieldValue.IsZero() {
+			continue
+		}
+		values[i] = fieldValue
+		count++
+	}
+	enc.encodeMapLen(count)
+	for i, field := range fields {
+		if !values[i].IsValid() {
+			continue
+		}
+		enc.encodeString(field.name)
+		err = enc.encode(values[i])
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+type msgpackDecoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+// enter counts a level of nesting, leave is deferred after it.
+func (dec *msgpackDecoder) enter() error {
+	dec.depth++
+	if dec.depth > msgpackMaxDepth {
+		return errMsgpackDepth
+	}
+	return nil
+}
+
+func (dec *msgpackDecoder) leave() {
+	dec.depth--
+}
+
+// preallocSize returns the number of items allocated for a container
+// of size items.
+func preallocSize(size int) int {
+	if size > msgpackMaxPrealloc {
+		return msgpackMaxPrealloc
+	}
+	return size
+}
+
+func (dec *msgpackDecoder) peek() (byte, error) {
+	if dec.pos >= len(dec.data) {
+		return 0, errMsgpackShort
+	}
+	return dec.data[dec.pos], nil
+}
+
+func (dec *msgpackDecoder) next(size int) ([]byte, error) {
+	if size < 0 || dec.pos+size > len(dec.data) {
+		return nil, errMsgpackShort
+	}
+	chunk := dec.data[dec.pos : dec.pos+size]
+	dec.pos += size
+	return chunk, nil
+}
+
+func (dec *msgpackDecoder) readUint(size int) (uint64, error) {
+	chunk, err := dec.next(size)
+	if err != nil {
+		return 0, err
+	}
+	var value uint64
+	for _, b := range chunk {
+		value = value<<8 | uint64(b)
+	}
+	return value, err
+}
+
+func (dec *msgpackDecoder) readLen(code byte) (int, error) {
+	var size uint64
+	var err error
+	switch code {
+	case mpStr8, mpBin8, mpExt8:
+		size, err = dec.readUint(1)
+	case mpStr16, mpBin16, mpArray16, mpMap16, mpExt16:
+		size, err = dec.readUint(2)
+	case mpStr32, mpBin32, mpArray32, mpMap32, mpExt32:
+		size, err = dec.readUint(4)
+	}
+	if size > uint64(len(dec.data)) {
+		return 0, errMsgpackShort
+	}
+	return int(size), err
+}
+
+// decodeAny decodes the next item into a generic value: nil, bool,
+// int64, uint64, float64, string, []byte, time.Time, []any or
+// map[string]any.
+func (dec *msgpackDecoder) decodeAny() (any, error) {
+	code, err := dec.peek()
+	if err != nil {
+		return nil, err
+	}
+	dec.pos++
+	switch {
+	case code <= 0x7f:
+		return int64(code), err
+	case code >= 0xe0:
+		return int64(int8(code)), err
+	case code&0xe0 == 0xa0:
+		chunk, err := dec.next(int(code & 0x1f))
+		return string(chunk), err
+	case code&0xf0 == 0x90:
+		return dec.decodeAnyArray(int(code & 0x0f))
+	case code&0xf0 == 0x80:
+		return dec.decodeAnyMap(int(code & 0x0f))
+	}
+	switch code {
+	case mpNil:
+		return nil, err
+	case mpFalse:
+		return false, err
+	case mpTrue:
+		return true, err
+	case mpUint8, mpUint16, mpUint32, mpUint64:
+		value, err := dec.readUint(1 << (code - mpUint8))
+		if value <= math.MaxInt64 {
+			return int64(value), err
+		}
+		return value, err
+	case mpInt8:
+		value, err := dec.readUint(1)
+		return int64(int8(value)), err
+	case mpInt16:
+		value, err := dec.readUint(2)
+		return int64(int16(value)), err
+	case mpInt32:
+		value, err := dec.readUint(4)
+		return int64(int32(value)), err
+	case mpInt64:
+		value, err := dec.readUint(8)
+		return int64(value), err
+	case mpFloat32:
+		value, err := dec.readUint(4)
+		return float64(math.Float32frombits(uint32(value))), err
+	case mpFloat64:
+		value, err := dec.readUint(8)
+		return math.Float64frombits(value), err
+	case mpStr8, mpStr16, mpStr32:
+		size, err := dec.readLen(code)
+		if err != nil {
+			return nil, err
+		}
+		chunk, err := dec.next(size)
+		return string(chunk), err
+	case mpBin8, mpBin16, mpBin32:
+		size, err := dec.readLen(code)
+		if err != nil {
+			return nil, err
+		}
+		chunk, err := dec.next(size)
+		return append([]byte(nil), chunk...), err
+	case mpArray16, mpArray32:
+		size, err := dec.readLen(code)
+		if err != nil {
+			return nil, err
+		}
+		return dec.decodeAnyArray(size)
+	case mpMap16, mpMap32:
+		size, err := dec.readLen(code)
+		if err != nil {
+			return nil, err
+		}
+		return dec.decodeAnyMap(size)
+	case mpFixExt1, mpFixExt2, mpFixExt4, mpFixExt8, mpFixExt16, mpExt8, mpExt16, mpExt32:
+		return dec.decodeExt(code)
+	}
+	return nil, fmt.Errorf("msgpack: unknown type code 0x%x", code)
+}
+
+// skip moves past the next item without decoding it.
+func (dec *msgpackDecoder) skip() error {
+	err := dec.enter()
+	defer dec.leave()
+	if err != nil {
+		return err
+	}
+	code, err := dec.peek()
+	if err != nil {
+		return err
+	}
+	dec.pos++
+	var size, items int
+	switch {
+	case code <= 0x7f, code >= 0xe0, code == mpNil, code == mpFalse, code == mpTrue:
+		return err
+	case code&0xe0 == 0xa0:
+		size = int(code & 0x1f)
+	case code&0xf0 == 0x90:
+		items = int(code & 0x0f)
+	case code&0xf0 == 0x80:
+		items = 2 * int(code&0x0f)
+	case code >= mpUint8 && code <= mpUint64:
+		size = 1 << (code - mpUint8)
+	case code >= mpInt8 && code <= mpInt64:
+		size = 1 << (code - mpInt8)
+	case code == mpFloat32:
+		size = 4
+	case code == mpFloat64:
+		size = 8
+	case code >= mpFixExt1 && code <= mpFixExt16:
+		size = 1 + 1<<(code-mpFixExt1)
+	case code == mpExt8 || code == mpExt16 || code == mpExt32:
+		size, err = dec.readLen(code)
+		size++
+	case code == mpStr8 || code == mpStr16 || code == mpStr32, code == mpBin8 || code == mpBin16 || code == mpBin32:
+		size, err = dec.readLen(code)
+	case code == mpArray16 || code == mpArray32:
+		items, err = dec.readLen(code)
+	case code == mpMap16 || code == mpMap32:
+		items, err = dec.readLen(code)
+		items *= 2
+	default:
+		return fmt.Errorf("msgpack: unknown type code 0x%x", code)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = dec.next(size)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < items; i++ {
+		err = dec.skip()
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (dec *msgpackDecoder) decodeAnyArray(size int) (any, error) {
+	err := dec.enter()
+	defer dec.leave()
+	if err != nil {
+		return nil, err
+	}
+	if size > len(dec.data) {
+		return nil, errMsgpackShort
+	}
+	items := make([]any, size)
+	for i := range items {
+		items[i], err = dec.decodeAny()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return items, err
+}
+
+func (dec *msgpackDecoder) decodeAnyMap(size int) (any, error) {
+	err := dec.enter()
+	defer dec.leave()
+	if err != nil {
+		return nil, err
+	}
+	if size > len(dec.data) {
+		return nil, errMsgpackShort
+	}
+	items := make(map[string]any, preallocSize(size))
+	for i := 0; i < size; i++ {
+		key, err := dec.decodeAny()
+		if err != nil {
+			return nil, err
+		}
+		items[fmt.Sprint(key)], err = dec.decodeAny()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return items, err
+}
+
+func (dec *msgpackDecoder) decodeExt(code byte) (any, error) {
+	var size int
+	var err error
+	switch code {
+	case mpFixExt1, mpFixExt2, mpFixExt4, mpFixExt8, mpFixExt16:
+		size = 1 << (code - mpFixExt1)
+	default:
+		size, err = dec.readLen(code)
+		if err != nil {
+			return nil, err
+		}
+	}
+	extType, err := dec.next(1)
+	if err != nil {
+		return nil, err
+	}
+	chunk, err := dec.next(size)
+	if err != nil {
+		return nil, err
+	}
+	if extType[0] != mpTimeExt {
+		return append([]byte(nil), chunk...), err
+	}
+	switch size {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(chunk)), 0), err
+	case 8:
+		value := binary.BigEndian.Uint64(chunk)
+		return time.Unix(int64(value&(1<<34-1)), int64(value>>34)), err
+	case 12:
+		nsec := binary.BigEndian.Uint32(chunk[0:4])
+		sec := binary.BigEndian.Uint64(chunk[4:12])
+		return time.Unix(int64(sec), int64(nsec)), err
+	}
+	return nil, fmt.Errorf("msgpack: bad timestamp size %d", size)
+}
+
+func (dec *msgpackDecoder) decode(value reflect.Value) error {
+	var err error
+	code, err := dec.peek()
+	if err != nil {
+		return err
+	}
+	if value.Type() == typeOfRawValue {
+		start := dec.pos
+		err = dec.skip()
+		if err != nil {
+			return err
+		}
+		value.SetBytes(append(value.Bytes()[0:0], dec.data[start:dec.pos]...))
+		return err
+	}
+	if code == mpNil {
+		dec.pos++
+		switch value.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+			value.Set(reflect.Zero(value.Type()))
+		}
+		return err
+	}
+
+	switch value.Kind() {
+	case reflect.Pointer:
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		return dec.decode(value.Elem())
+	case reflect.Interface:
+		if !value.IsNil() && value.Elem().Kind() == reflect.Pointer && !value.Elem().IsNil() {
+			return dec.decode(value.Elem())
+		}
+		if value.NumMethod() > 0 {
+			return fmt.Errorf("msgpack: cannot decode into %s", value.Type())
+		}
+		item, err := dec.decodeAny()
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			value.Set(reflect.Zero(value.Type()))
+			return err
+		}
+		value.Set(reflect.ValueOf(item))
+		return err
+	case reflect.Struct:
+		if value.Type() != typeOfTime {
+			return dec.decodeStruct(value)
+		}
+	case reflect.Map:
+		return dec.decodeMap(value)
+	case reflect.Slice, reflect.Array:
+		if value.Type().Elem().Kind() != reflect.Uint8 || code&0xf0 == 0x90 || code == mpArray16 || code == mpArray32 {
+			return dec.decodeArray(value)
+		}
+	}
+
+	item, err := dec.decodeAny()
+	if err != nil {
+		return err
+	}
+	return assignMsgpack(value, item)
+}
+
+func (dec *msgpackDecoder) decodeStruct(value reflect.Value) error {
+	err := dec.enter()
+	defer dec.leave()
+	if err != nil {
+		return err
+	}
+	size, err := dec.mapLen()
+	if err != nil {
+		return err
+	}
+	fields := msgpackFields(value.Type())
+	for i := 0; i < size; i++ {
+		key, err := dec.decodeAny()
+		if err != nil {
+			return err
+		}
+		name := fmt.Sprint(key)
+		var target reflect.Value
+		for _, field := range fields {
+			if field.name == name || (!target.IsValid() && strings.EqualFold(field.name, name)) {
+				target, err = value.FieldByIndexErr(field.index)
+				if err != nil {
+					return fmt.Errorf("msgpack: %v", err)
+				}
+			}
+		}
+		if !target.IsValid() {
+			_, err = dec.decodeAny()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err = dec.decode(target)
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (dec *msgpackDecoder) decodeMap(value reflect.Value) error {
+	err := dec.enter()
+	defer dec.leave()
+	if err != nil {
+		return err
+	}
+	size, err := dec.mapLen()
+	if err != nil {
+		return err
+	}
+	rtype := value.Type()
+	if value.IsNil() {
+		value.Set(reflect.MakeMapWithSize(rtype, preallocSize(size)))
+	}
+	for i := 0; i < size; i++ {
+		key := reflect.New(rtype.Key()).Elem()
+		err = dec.decode(key)
+		if err != nil {
+			return err
+		}
+		elem := reflect.New(rtype.Elem()).Elem()
+		err = dec.decode(elem)
+		if err != nil {
+			return err
+		}
+		value.SetMapIndex(key, elem)
+	}
+	return err
+}
+
+func (dec *msgpackDecoder) decodeArray(value reflect.Value) error {
+	err := dec.enter()
+	defer dec.leave()
+	if err != nil {
+		return err
+	}
+	code, err := dec.peek()
+	if err != nil {
+		return err
+	}
+	var size int
+	switch {
+	case code&0xf0 == 0x90:
+		dec.pos++
+		size = int(code & 0x0f)
+	case code == mpArray16 || code == mpArray32:
+		dec.pos++
+		size, err = dec.readLen(code)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("msgpack: cannot decode type code 0x%x into %s", code, value.Type())
+	}
+	slice := value.Kind() == reflect.Slice
+	if slice {
+		// The slice grows with the decoded elements, so that a long
+		// array header does not allocate wide elements at once.
+		value.Set(reflect.MakeSlice(value.Type(), 0, preallocSize(size)))
+	}
+	for i := 0; i < size; i++ {
+		if slice {
+			value.Set(reflect.Append(value, reflect.Zero(value.Type().Elem())))
+		}
+		if i >= value.Len() {
+			_, err = dec.decodeAny()
+		} else {
+			err = dec.decode(value.Index(i))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (dec *msgpackDecoder) mapLen() (int, error) {
+	code, err := dec.peek()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case code&0xf0 == 0x80:
+		dec.pos++
+		return int(code & 0x0f), err
+	case code == mpMap16 || code == mpMap32:
+		dec.pos++
+		return dec.readLen(code)
+	}
+	return 0, fmt.Errorf("msgpack: expected map, got type code 0x%x", code)
+}
+
+func assignMsgpack(value reflect.Value, item any) error {
+	var err error
+	mismatch := fmt.Errorf("msgpack: cannot decode %T into %s", item, value.Type())
+	switch value.Kind() {
+	case reflect.Bool:
+		flag, ok := item.(bool)
+		if !ok {
+			return mismatch
+		}
+		value.SetBool(flag)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, ok := item.(int64)
+		if !ok {
+			return mismatch
+		}
+		if value.OverflowInt(number) {
+			return fmt.Errorf("msgpack: value %d overflows %s", number, value.Type())
+		}
+		value.SetInt(number)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var number uint64
+		switch item := item.(type) {
+		case int64:
+			if item < 0 {
+				return mismatch
+			}
+			number = uint64(item)
+		case uint64:
+			number = item
+		default:
+			return mismatch
+		}
+		if value.OverflowUint(number) {
+			return fmt.Errorf("msgpack: value %d overflows %s", number, value.Type())
+		}
+		value.SetUint(number)
+	case reflect.Float32, reflect.Float64:
+		switch item := item.(type) {
+		case float64:
+			value.SetFloat(item)
+		case int64:
+			value.SetFloat(float64(item))
+		case uint64:
+			value.SetFloat(float64(item))
+		default:
+			return mismatch
+		}
+	case reflect.String:
+		switch item := item.(type) {
+		case string:
+			value.SetString(item)
+		case []byte:
+			value.SetString(string(item))
+		default:
+			return mismatch
+		}
+	case reflect.Slice:
+		switch item := item.(type) {
+		case []byte:
+			value.SetBytes(item)
+		case string:
+			value.SetBytes([]byte(item))
+		default:
+			return mismatch
+		}
+	case reflect.Array:
+		chunk, ok := item.([]byte)
+		if !ok {
+			return mismatch
+		}
+		reflect.Copy(value, reflect.ValueOf(chunk))
+	case reflect.Struct:
+		stamp, ok := item.(time.Time)
+		if !ok || value.Type() != typeOfTime {
+			return mismatch
+		}
+		value.Set(reflect.ValueOf(stamp))
+	default:
+		return mismatch
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"net"
+)
+
+// Notify sends a notification: the server runs the handler of the method
+// but sends nothing back, and the call returns once the request is
+// written. Errors of the handler are not reported to the client.
+func Notify(ctx context.Context, address string, method string, param any, auth *Auth, opts ...CallOption) error {
+	var err error
+
+	conn, err := dial(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return ConnNotify(ctx, conn, method, param, auth, opts...)
+}
+
+// ConnNotify is Notify over an established connection, which the server
+// closes after the notification.
+func ConnNotify(ctx context.Context, conn net.Conn, method string, param any, auth *Auth, opts ...CallOption) error {
+	var err error
+
+	content := CreateContent(conn)
+	content.applyOptions(opts)
+	content.reqBlock.Method = method
+	if param != nil {
+		content.reqBlock.Params = param
+	}
+	if auth != nil {
+		content.reqBlock.Auth = auth
+	}
+	content.reqHeader.setFlag(flagNotify)
+
+	err = content.createRequest(ctx)
+	if err != nil {
+		return err
+	}
+	stop := content.watchContext(ctx, conn)
+	defer stop()
+
+	err = content.writeRequest()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	return err
+}
+
+// LocalNotify runs the handler with a notification and returns the error
+// of the handler.
+func LocalNotify(method string, param any, auth *Auth, handler HandlerFunc, opts ...CallOption) error {
+	var err error
+
+	cliConn, srvConn := NewFConn()
+
+	content := CreateContent(cliConn)
+	content.applyOptions(opts)
+	content.reqBlock.Method = method
+	if param != nil {
+		content.reqBlock.Params = param
+	}
+	if auth != nil {
+		content.reqBlock.Auth = auth
+	}
+	content.reqHeader.setFlag(flagNotify)
+
+	err = content.createRequest(context.Background())
+	if err != nil {
+		return err
+	}
+	err = content.writeRequest()
+	if err != nil {
+		return err
+	}
+	return LocalService(srvConn, handler)
+}
+
+// IsNotification reports whether the handler runs for a notification,
+// whose result and error are not sent to the client.
+func (content *Content) IsNotification() bool {
+	return content.reqHeader.hasFlag(flagNotify)
+}
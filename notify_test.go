@@ -0,0 +1,78 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const auditMethod string = "audit"
+
+var auditEvents = make(chan string, 4)
+
+func auditHandler(content *Content) error {
+	var err error
+	params := &HelloParams{}
+	err = content.BindParams(params)
+	if err != nil {
+		return err
+	}
+	if !content.IsNotification() {
+		return errors.New("not a notification")
+	}
+	// The client is gone, but the handler is not canceled.
+	time.Sleep(100 * time.Millisecond)
+	if content.Context().Err() != nil {
+		return content.Context().Err()
+	}
+	auditEvents <- params.Message
+	return content.SendResult(NewEmptyResult(), 0)
+}
+
+func TestNotify(t *testing.T) {
+	serv := NewService()
+	serv.Handler(auditMethod, auditHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := Notify(ctx, address, auditMethod, &HelloParams{Message: "login"}, nil)
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 100*time.Millisecond)
+
+	select {
+	case event := <-auditEvents:
+		require.Equal(t, "login", event)
+	case <-time.After(2 * time.Second):
+		t.Fatal("notification is not handled")
+	}
+
+	// Nothing is sent back, the server just closes the connection.
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+	err = ConnNotify(ctx, conn, auditMethod, &HelloParams{Message: "logout"}, nil)
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buffer := make([]byte, 1)
+	read, _ := conn.Read(buffer)
+	require.Equal(t, 0, read)
+	require.Equal(t, "logout", <-auditEvents)
+
+	err = Exec(ctx, address, auditMethod, &HelloParams{Message: "exec"}, nil, nil)
+	require.EqualError(t, err, "not a notification")
+
+	err = LocalNotify(auditMethod, &HelloParams{Message: "local"}, nil, auditHandler)
+	require.NoError(t, err)
+	require.Equal(t, "local", <-auditEvents)
+}
@@ -0,0 +1,21 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+// CallOption configures a single client call.
+type CallOption func(content *Content)
+
+func (content *Content) applyOptions(opts []CallOption) {
+	for _, opt := range opts {
+		opt(content)
+	}
+}
+
+// WithCodec selects the codec of the request and response blocks.
+func WithCodec(codec Codec) CallOption {
+	return func(content *Content) {
+		content.codec = codec
+	}
+}
@@ -0,0 +1,298 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultParallelParts is the number of the connections of a
+	// parallel transfer.
+	DefaultParallelParts int = 4
+	// minPartSize is the least size of a part of a parallel transfer.
+	minPartSize int64 = 64 * 1024
+)
+
+// Parallel sets up a parallel transfer, which sends the parts of the
+// binary data over several connections at once.
+type Parallel struct {
+	// Parts is the number of the parts, DefaultParallelParts if zero.
+	Parts int
+	// Retries is the number of the retries of a failed part.
+	Retries int
+	// Digest is the digest of the whole data in the algo:hex form, which
+	// the receiver checks. For an upload it can be the algorithm only,
+	// then the digest is computed from the data.
+	Digest string
+}
+
+// partsOf splits the data of the size into the ranges of the parts.
+func (parallel Parallel) partsOf(size int64) []Range {
+	count := int64(parallel.Parts)
+	if count <= 0 {
+		count = int64(DefaultParallelParts)
+	}
+	if size/count < minPartSize {
+		count = size/minPartSize + 1
+	}
+	partSize := (size + count - 1) / count
+	parts := make([]Range, 0, count)
+	for offset := int64(0); offset < size; offset += partSize {
+		length := partSize
+		if offset+length > size {
+			length = size - offset
+		}
+		parts = append(parts, Range{Offset: offset, Length: length, Total: size})
+	}
+	return parts
+}
+
+// ParallelGet downloads the binary data of the method into writer by
+// parts, each over its own connection. A broken part is resumed from the
+// offset it has reached. The method must serve ranges, otherwise the data
+// is downloaded at once. The digest, if set, is checked when writer is
+// also an io.ReaderAt. It returns the size of the data.
+func ParallelGet(ctx context.Context, address string, method string, writer io.WriterAt, param, result any, auth *Auth, parallel Parallel, opts ...CallOption) (int64, error) {
+	var err error
+	if len(parallel.Digest) > 0 {
+		_, _, err = parseDigest(parallel.Digest)
+		if err != nil {
+			return 0, err
+		}
+	}
+	// The first call takes the size of the data.
+	head := &Range{}
+	output := &offsetWriter{
+		writer: writer,
+		rng:    head,
+	}
+	headOpts := append(opts[0:len(opts):len(opts)], WithRange(head))
+	err = Get(ctx, address, method, output, param, result, auth, headOpts...)
+	if err != nil {
+		return 0, err
+	}
+	total := head.Total
+	if head.Length < total {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var wg sync.WaitGroup
+		errs := make(chan error, 1)
+		for _, part := range parallel.partsOf(total) {
+			wg.Add(1)
+			go func(part Range) {
+				defer wg.Done()
+				partErr := getPart(ctx, address, method, writer, part, param, auth, parallel.Retries, opts)
+				if partErr != nil {
+					select {
+					case errs <- partErr:
+						cancel()
+					default:
+					}
+				}
+			}(part)
+		}
+		wg.Wait()
+		select {
+		case err = <-errs:
+			return total, err
+		default:
+		}
+	}
+	if len(parallel.Digest) > 0 {
+		reader, ok := writer.(io.ReaderAt)
+		if !ok {
+			err = errors.New("digest check needs io.ReaderAt")
+			return total, err
+		}
+		err = checkDigest(io.NewSectionReader(reader, 0, total), parallel.Digest)
+	}
+	return total, err
+}
+
+// getPart downloads the part and resumes it on failure.
+func getPart(ctx context.Context, address string, method string, writer io.WriterAt, part Range, param any, auth *Auth, retries int, opts []CallOption) error {
+	var err error
+	end := part.Offset + part.Length
+	offset := part.Offset
+	for attempt := 0; attempt <= retries; attempt++ {
+		rng := &Range{
+			Offset: offset,
+			Length: end - offset,
+		}
+		output := &offsetWriter{
+			writer: writer,
+			rng:    rng,
+		}
+		partOpts := append(opts[0:len(opts):len(opts)], WithRange(rng))
+		err = Get(ctx, address, method, output, param, nil, auth, partOpts...)
+		if output.started {
+			offset = output.offset
+		}
+		if err == nil {
+			if offset != end {
+				err = errors.New("part is not complete")
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return contextError(ctx, err)
+		}
+	}
+	return err
+}
+
+// withPartRange describes the part of the request binary data.
+func withPartRange(rng Range) CallOption {
+	return func(content *Content) {
+		content.reqBlock.Range = &rng
+	}
+}
+
+// ParallelPut uploads the binary data of the size from reader by parts,
+// each over its own connection, and retries a failed part. The last call
+// has no data and carries the digest of the whole data, and its result is
+// decoded into result. The handler of the method writes the parts with
+// ReadBinAt.
+func ParallelPut(ctx context.Context, address string, method string, reader io.ReaderAt, size int64, param, result any, auth *Auth, parallel Parallel, opts ...CallOption) error {
+	var err error
+	digest := parallel.Digest
+	algo := ""
+	if len(digest) > 0 {
+		if strings.Contains(digest, ":") {
+			_, _, err = parseDigest(digest)
+		} else {
+			algo = digest
+			_, err = newDigest(algo)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	partCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case errs <- err:
+			cancel()
+		default:
+		}
+	}
+	if len(algo) > 0 {
+		// The digest is computed while the parts are sent.
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hash, _ := newDigest(algo)
+			_, err := io.Copy(hash, io.NewSectionReader(reader, 0, size))
+			if err != nil {
+				fail(err)
+				return
+			}
+			digest = Digest{Algo: algo, Sum: hash.Sum(nil)}.String()
+		}()
+	}
+	for _, part := range parallel.partsOf(size) {
+		wg.Add(1)
+		go func(part Range) {
+			defer wg.Done()
+			err := putPart(partCtx, address, method, reader, part, param, auth, parallel.Retries, opts)
+			if err != nil {
+				fail(err)
+			}
+		}(part)
+	}
+	wg.Wait()
+	select {
+	case err = <-errs:
+		return err
+	default:
+	}
+
+	last := Range{
+		Offset: size,
+		Total:  size,
+		Digest: digest,
+	}
+	lastOpts := append(opts[0:len(opts):len(opts)], withPartRange(last))
+	return Put(ctx, address, method, bytes.NewReader(nil), 0, param, result, auth, lastOpts...)
+}
+
+// putPart uploads the part and sends it again on failure.
+func putPart(ctx context.Context, address string, method string, reader io.ReaderAt, part Range, param any, auth *Auth, retries int, opts []CallOption) error {
+	var err error
+	partOpts := append(opts[0:len(opts):len(opts)], withPartRange(part))
+	for attempt := 0; attempt <= retries; attempt++ {
+		section := io.NewSectionReader(reader, part.Offset, part.Length)
+		err = Put(ctx, address, method, section, part.Length, param, nil, auth, partOpts...)
+		if err == nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return contextError(ctx, err)
+		}
+	}
+	return err
+}
+
+// ReadBinAt writes the request binary data into writer at the offset of
+// the range of the request, which a parallel upload sends with each part.
+// The last call of a parallel upload has no data, and the digest of the
+// whole data is checked if writer is also an io.ReaderAt.
+func (content *Content) ReadBinAt(ctx context.Context, writer io.WriterAt) (Range, error) {
+	var err error
+	rng, ok := content.Range()
+	if !ok {
+		rng = Range{
+			Length: content.BinSize(),
+			Total:  content.BinSize(),
+		}
+	}
+	if rng.Length != content.BinSize() {
+		err = errors.New("range does not match binary data")
+		return rng, err
+	}
+	if rng.Offset < 0 || (rng.Total > 0 && rng.Offset+rng.Length > rng.Total) {
+		return rng, ErrRangeNotSatisfiable
+	}
+	output := &offsetWriter{
+		writer: writer,
+		rng:    &rng,
+	}
+	err = content.ReadBin(ctx, output)
+	if err != nil {
+		return rng, err
+	}
+	if len(rng.Digest) == 0 {
+		return rng, err
+	}
+	reader, ok := writer.(io.ReaderAt)
+	if !ok {
+		err = errors.New("digest check needs io.ReaderAt")
+		return rng, err
+	}
+	err = checkDigest(io.NewSectionReader(reader, 0, rng.Total), rng.Digest)
+	return rng, err
+}
+
+// SendBinAt sends the result with the asked range of the binary data of
+// the total size from reader.
+func (content *Content) SendBinAt(result any, reader io.ReaderAt, total int64) (Range, error) {
+	var err error
+	rng, err := content.SendRange(result, total)
+	if err != nil {
+		return rng, err
+	}
+	_, err = io.Copy(content.BinWriter(), io.NewSectionReader(reader, rng.Offset, rng.Length))
+	return rng, err
+}
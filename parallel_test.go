@@ -0,0 +1,145 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	parallelGetMethod string = "parallelGet"
+	parallelPutMethod string = "parallelPut"
+)
+
+// memFile is a file in memory which is written at offsets.
+type memFile struct {
+	mutex sync.Mutex
+	data  []byte
+}
+
+func (file *memFile) WriteAt(data []byte, offset int64) (int, error) {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+	end := offset + int64(len(data))
+	if end > int64(len(file.data)) {
+		file.data = append(file.data, make([]byte, end-int64(len(file.data)))...)
+	}
+	return copy(file.data[offset:], data), nil
+}
+
+func (file *memFile) ReadAt(data []byte, offset int64) (int, error) {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+	if offset >= int64(len(file.data)) {
+		return 0, io.EOF
+	}
+	read := copy(data, file.data[offset:])
+	if read < len(data) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+func (file *memFile) Bytes() []byte {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+	return file.data
+}
+
+var (
+	parallelFile  = &memFile{}
+	parallelCalls atomic.Int32
+)
+
+// parallelGetHandler breaks the second call in the middle of the data.
+func parallelGetHandler(content *Content) error {
+	var err error
+	total := int64(len(downloadData))
+	if parallelCalls.Add(1) != 2 {
+		_, err = content.SendBinAt(NewEmptyResult(), bytes.NewReader(downloadData), total)
+		return err
+	}
+	rng, err := content.SendRange(NewEmptyResult(), total)
+	if err != nil {
+		return err
+	}
+	_, err = content.BinWriter().Write(downloadData[rng.Offset : rng.Offset+rng.Length/2])
+	if err != nil {
+		return err
+	}
+	return errors.New("server failure")
+}
+
+// parallelPutHandler fails the second call before the data is read.
+func parallelPutHandler(content *Content) error {
+	var err error
+	if parallelCalls.Add(1) == 2 {
+		return errors.New("server failure")
+	}
+	rng, err := content.ReadBinAt(content.Context(), parallelFile)
+	if err != nil {
+		return err
+	}
+	return content.SendResult(&HelloResult{Message: rng.Digest}, 0)
+}
+
+func TestParallel(t *testing.T) {
+	serv := NewService()
+	serv.Handler(parallelGetMethod, parallelGetHandler)
+	serv.Handler(parallelPutMethod, parallelPutHandler)
+	serv.Handler(LoadMethod, loadHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sum := sha256.Sum256(downloadData)
+	digest := DigestSHA256 + ":" + hex.EncodeToString(sum[:])
+
+	parallelCalls.Store(0)
+	target := &memFile{}
+	total, err := ParallelGet(ctx, address, parallelGetMethod, target, nil, nil, nil,
+		Parallel{Parts: 4, Retries: 1, Digest: digest})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(downloadData)), total)
+	require.Equal(t, downloadData, target.Bytes())
+	require.Equal(t, int32(6), parallelCalls.Load())
+
+	parallelCalls.Store(1)
+	_, err = ParallelGet(ctx, address, parallelGetMethod, &memFile{}, nil, nil, nil,
+		Parallel{Digest: DigestSHA256 + ":" + hex.EncodeToString(make([]byte, 32))})
+	require.ErrorIs(t, err, ErrDigestMismatch)
+
+	// A method without ranges sends the data at once.
+	target = &memFile{}
+	total, err = ParallelGet(ctx, address, LoadMethod, target, &LoadParams{}, &LoadResult{}, nil, Parallel{})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(target.Bytes())), total)
+
+	parallelCalls.Store(0)
+	result := &HelloResult{}
+	err = ParallelPut(ctx, address, parallelPutMethod, bytes.NewReader(downloadData), int64(len(downloadData)),
+		nil, result, nil, Parallel{Parts: 8, Retries: 1, Digest: DigestSHA256})
+	require.NoError(t, err)
+	require.Equal(t, digest, result.Message)
+	require.Equal(t, downloadData, parallelFile.Bytes())
+
+	// The server checks the digest of the whole data.
+	parallelCalls.Store(2)
+	err = ParallelPut(ctx, address, parallelPutMethod, bytes.NewReader(downloadData), int64(len(downloadData)),
+		nil, result, nil, Parallel{Digest: DigestSHA256 + ":" + hex.EncodeToString(make([]byte, 32))})
+	require.EqualError(t, err, ErrDigestMismatch.Error())
+}
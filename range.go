@@ -0,0 +1,155 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrRangeNotSatisfiable is returned for a range beyond the data.
+var ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// Range is a part of the binary data of a response. A request asks for
+// Length bytes from Offset, or for the data up to its end if Length is
+// negative. A response tells the part it carries and the Total size of
+// the data.
+type Range struct {
+	Offset int64 `json:"offset"           msgpack:"offset"`
+	Length int64 `json:"length"           msgpack:"length"`
+	Total  int64 `json:"total,omitempty"  msgpack:"total,omitempty"`
+	// Digest is the digest of the whole data in the algo:hex form, which
+	// the last call of a parallel upload carries.
+	Digest string `json:"digest,omitempty" msgpack:"digest,omitempty"`
+}
+
+// WithRange asks for the range of the response binary data. The range
+// served by the method is stored back into rng; it is the whole data if
+// the method does not serve ranges.
+func WithRange(rng *Range) CallOption {
+	return func(content *Content) {
+		content.reqBlock.Range = &Range{
+			Offset: rng.Offset,
+			Length: rng.Length,
+		}
+		content.resRange = rng
+	}
+}
+
+// bindRange stores the range of the response.
+func (content *Content) bindRange() {
+	if content.resRange == nil {
+		return
+	}
+	if content.resBlock.Range != nil {
+		*content.resRange = *content.resBlock.Range
+		return
+	}
+	binSize := content.resHeader.binSize
+	*content.resRange = Range{
+		Length: binSize,
+		Total:  binSize,
+	}
+}
+
+// Range returns the range of the binary data asked by the client. It is
+// false for a request of the whole data.
+func (content *Content) Range() (Range, bool) {
+	if content.reqBlock.Range == nil {
+		return Range{Length: -1}, false
+	}
+	return *content.reqBlock.Range, true
+}
+
+// SendRange sends the result with the asked range of the binary data of
+// the total size. The range is cut to the size of the data, and the
+// handler writes the bytes of the returned range to BinWriter.
+func (content *Content) SendRange(result any, total int64) (Range, error) {
+	var err error
+	rng := Range{
+		Length: total,
+		Total:  total,
+	}
+	asked, ok := content.Range()
+	if ok {
+		if asked.Offset < 0 || asked.Offset > total {
+			return rng, ErrRangeNotSatisfiable
+		}
+		rng.Offset = asked.Offset
+		rng.Length = total - asked.Offset
+		if asked.Length >= 0 && asked.Length < rng.Length {
+			rng.Length = asked.Length
+		}
+	}
+	content.resBlock.Range = &rng
+	err = content.SendResult(result, rng.Length)
+	return rng, err
+}
+
+// GetAt downloads the binary data of the method from the offset up to
+// its end into writer at the offsets of the data. It returns the offset
+// the data is stored up to, from which a broken download is resumed.
+func GetAt(ctx context.Context, address string, method string, writer io.WriterAt, offset int64, param, result any, auth *Auth, opts ...CallOption) (int64, error) {
+	var err error
+	rng := &Range{
+		Offset: offset,
+		Length: -1,
+	}
+	output := &offsetWriter{
+		writer: writer,
+		rng:    rng,
+	}
+	opts = append(opts, WithRange(rng))
+	err = Get(ctx, address, method, output, param, result, auth, opts...)
+	if output.started {
+		offset = output.offset
+	}
+	return offset, err
+}
+
+// GetFile downloads the binary data of the method into the file at
+// path. The download is resumed from the size of an existing file.
+func GetFile(ctx context.Context, address string, method string, path string, param, result any, auth *Auth, opts ...CallOption) error {
+	var err error
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	offset, err := GetAt(ctx, address, method, file, stat.Size(), param, result, auth, opts...)
+	if err != nil {
+		return err
+	}
+	// A file of the data which has been sent whole is cut to its size.
+	err = file.Truncate(offset)
+	if err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// offsetWriter writes the data of the served range at its offsets.
+type offsetWriter struct {
+	writer  io.WriterAt
+	rng     *Range
+	offset  int64
+	started bool
+}
+
+func (writer *offsetWriter) Write(data []byte) (int, error) {
+	if !writer.started {
+		writer.started = true
+		writer.offset = writer.rng.Offset
+	}
+	written, err := writer.writer.WriteAt(data, writer.offset)
+	writer.offset += int64(written)
+	return written, err
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const downloadMethod string = "download"
+
+var downloadData = func() []byte {
+	data := make([]byte, 1000000)
+	rand.Read(data)
+	return data
+}()
+
+func downloadHandler(content *Content) error {
+	var err error
+	total := int64(len(downloadData))
+	rng, err := content.SendRange(NewEmptyResult(), total)
+	if err != nil {
+		return err
+	}
+	reader := io.NewSectionReader(bytes.NewReader(downloadData), rng.Offset, rng.Length)
+	_, err = io.Copy(content.BinWriter(), reader)
+	return err
+}
+
+// bufferAt is a writer at offsets which fails beyond the limit.
+type bufferAt struct {
+	data  []byte
+	limit int64
+}
+
+func (buffer *bufferAt) WriteAt(data []byte, offset int64) (int, error) {
+	if buffer.limit > 0 && offset+int64(len(data)) > buffer.limit {
+		return 0, errors.New("disk full")
+	}
+	return copy(buffer.data[offset:], data), nil
+}
+
+func TestRange(t *testing.T) {
+	serv := NewService()
+	serv.Handler(downloadMethod, downloadHandler)
+	serv.Handler(LoadMethod, loadHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, opt := range []CallOption{WithCodec(JsonCodec), WithCodec(MsgpackCodec), WithCodec(GobCodec)} {
+		rng := &Range{Offset: 1000, Length: 5000}
+		buffer := bytes.NewBuffer(nil)
+		err := Get(ctx, address, downloadMethod, buffer, nil, nil, nil, WithRange(rng), opt)
+		require.NoError(t, err)
+		require.Equal(t, Range{Offset: 1000, Length: 5000, Total: 1000000}, *rng)
+		require.Equal(t, downloadData[1000:6000], buffer.Bytes())
+	}
+
+	// The range is cut to the end of the data.
+	rng := &Range{Offset: 999000, Length: 5000}
+	buffer := bytes.NewBuffer(nil)
+	err := Get(ctx, address, downloadMethod, buffer, nil, nil, nil, WithRange(rng))
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), rng.Length)
+	require.Equal(t, 1000, buffer.Len())
+
+	rng = &Range{Offset: 1000001, Length: -1}
+	err = Get(ctx, address, downloadMethod, buffer, nil, nil, nil, WithRange(rng))
+	require.EqualError(t, err, ErrRangeNotSatisfiable.Error())
+
+	// A method without ranges sends the whole data.
+	rng = &Range{Offset: 100, Length: -1}
+	buffer = bytes.NewBuffer(nil)
+	err = Get(ctx, address, LoadMethod, buffer, &LoadParams{}, &LoadResult{}, nil, WithRange(rng))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), rng.Offset)
+	require.Equal(t, int64(buffer.Len()), rng.Total)
+
+	// A broken download is resumed from its offset.
+	target := &bufferAt{data: make([]byte, len(downloadData)), limit: 300000}
+	offset, err := GetAt(ctx, address, downloadMethod, target, 0, nil, nil, nil)
+	require.Error(t, err)
+	require.Greater(t, offset, int64(0))
+	require.LessOrEqual(t, offset, int64(300000))
+	target.limit = 0
+	offset, err = GetAt(ctx, address, downloadMethod, target, offset, nil, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(downloadData)), offset)
+	require.Equal(t, downloadData, target.data)
+
+	path := filepath.Join(t.TempDir(), "download.bin")
+	require.NoError(t, os.WriteFile(path, downloadData[:400000], 0640))
+	err = GetFile(ctx, address, downloadMethod, path, nil, nil, nil)
+	require.NoError(t, err)
+	stored, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, downloadData, stored)
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	typeOfContent    = reflect.TypeOf((*Content)(nil))
+	typeOfContext    = reflect.TypeOf((*context.Context)(nil)).Elem()
+	typeOfError      = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfHandleFunc = reflect.TypeOf((HandlerFunc)(nil))
+)
+
+// RegisterError lists the exported methods of a receiver which were not
+// registered because of an unsuitable signature.
+type RegisterError struct {
+	Receiver string
+	Problems []string
+}
+
+func (rerr *RegisterError) Error() string {
+	return fmt.Sprintf("%s: unsuitable methods: %s", rerr.Receiver, strings.Join(rerr.Problems, "; "))
+}
+
+// Register registers the exported methods of the receiver as handlers
+// named "Type.Method", in the style of net/rpc. Suitable methods have
+// one of the signatures
+//
+//	func(ctx context.Context, params *P) (*R, error)
+//	func(content *Content, params *P) (*R, error)
+//	func(content *Content) error
+//
+// Suitable methods are registered even if some others are not; those are
+// reported by a *RegisterError.
+func (svc *Service) Register(receiver any) error {
+	var err error
+	err = checkReceiver(receiver)
+	if err != nil {
+		return err
+	}
+	rtype := reflect.TypeOf(receiver)
+	name := reflect.Indirect(reflect.ValueOf(receiver)).Type().Name()
+	if name == "" {
+		err = fmt.Errorf("register: receiver type %s has no name", rtype)
+		return err
+	}
+	return svc.RegisterName(name, receiver)
+}
+
+// checkReceiver rejects a nil receiver, whose methods can not be called.
+func checkReceiver(receiver any) error {
+	var err error
+	if receiver == nil {
+		err = fmt.Errorf("register: receiver is nil")
+		return err
+	}
+	rvalue := reflect.ValueOf(receiver)
+	if rvalue.Kind() == reflect.Pointer && rvalue.IsNil() {
+		err = fmt.Errorf("register: receiver is a nil %s", rvalue.Type())
+		return err
+	}
+	return err
+}
+
+// RegisterName is like Register but uses the given name instead of the
+// receiver type name.
+func (svc *Service) RegisterName(name string, receiver any) error {
+	var err error
+	err = checkReceiver(receiver)
+	if err != nil {
+		return err
+	}
+	rvalue := reflect.ValueOf(receiver)
+	rtype := rvalue.Type()
+
+	rerr := &RegisterError{
+		Receiver: name,
+		Problems: make([]string, 0),
+	}
+	for i := 0; i < rtype.NumMethod(); i++ {
+		method := rtype.Method(i)
+		if !method.IsExported() {
+			continue
+		}
+		handler, problem := svc.reflectHandler(rvalue.Method(i))
+		if problem != "" {
+			rerr.Problems = append(rerr.Problems, method.Name+": "+problem)
+			continue
+		}
+		opts := make([]MethodOption, 0)
+		ftype := method.Type
+		if ftype.NumIn() == 3 {
+			opts = append(opts, withTypes(ftype.In(2), ftype.Out(0)))
+		}
+		svc.Handler(name+"."+method.Name, handler, opts...)
+	}
+	if len(rerr.Problems) > 0 {
+		err = rerr
+		return err
+	}
+	return err
+}
+
+func withTypes(paramsType, resultType reflect.Type) MethodOption {
+	return func(info *MethodInfo) {
+		info.Params = schemaOfType(paramsType, make(map[reflect.Type]bool))
+		info.Result = schemaOfType(resultType, make(map[reflect.Type]bool))
+	}
+}
+
+func (svc *Service) reflectHandler(function reflect.Value) (HandlerFunc, string) {
+	ftype := function.Type()
+
+	if ftype.ConvertibleTo(typeOfHandleFunc) {
+		handler := function.Convert(typeOfHandleFunc).Interface().(HandlerFunc)
+		return handler, ""
+	}
+	if ftype.NumIn() != 2 {
+		return nil, "wrong number of arguments"
+	}
+	first := ftype.In(0)
+	if first != typeOfContext && first != typeOfContent {
+		return nil, "first argument is not context.Context or *Content"
+	}
+	paramsType := ftype.In(1)
+	if paramsType.Kind() != reflect.Pointer {
+		return nil, "params argument is not a pointer"
+	}
+	if ftype.NumOut() != 2 {
+		return nil, "wrong number of results"
+	}
+	if ftype.Out(0).Kind() != reflect.Pointer {
+		return nil, "result is not a pointer"
+	}
+	if ftype.Out(1) != typeOfError {
+		return nil, "last result is not error"
+	}
+
+	handler := func(content *Content) error {
+		var err error
+		params := reflect.New(paramsType.Elem())
+		err = content.BindParams(params.Interface())
+		if err != nil {
+			content.SendError(err)
+			return err
+		}
+		var first reflect.Value
+		if ftype.In(0) == typeOfContent {
+			first = reflect.ValueOf(content)
+		} else {
+			first = reflect.ValueOf(content.Context())
+		}
+		out := function.Call([]reflect.Value{first, params})
+		if !out[1].IsNil() {
+			err = out[1].Interface().(error)
+		}
+		if out[0].IsNil() {
+			return content.sendReturn(nil, err)
+		}
+		return content.sendReturn(out[0].Interface(), err)
+	}
+	return handler, ""
+}
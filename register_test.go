@@ -0,0 +1,80 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type Greeter struct{}
+
+func (greeter *Greeter) Hello(ctx context.Context, params *HelloParams) (*HelloResult, error) {
+	result := &HelloResult{
+		Message: "hello, " + params.Message,
+	}
+	return result, nil
+}
+
+func (greeter *Greeter) Fail(content *Content, params *HelloParams) (*HelloResult, error) {
+	return nil, errors.New("failed")
+}
+
+func (greeter *Greeter) Raw(content *Content) error {
+	result := &HelloResult{
+		Message: "raw",
+	}
+	return content.SendResult(result, 0)
+}
+
+func (greeter *Greeter) Helper(message string) string {
+	return message
+}
+
+func TestServiceRegister(t *testing.T) {
+	serv := NewService()
+	err := serv.Register(&Greeter{})
+
+	var rerr *RegisterError
+	require.ErrorAs(t, err, &rerr)
+	require.Equal(t, "Greeter", rerr.Receiver)
+	require.Len(t, rerr.Problems, 1)
+	require.Contains(t, rerr.Problems[0], "Helper")
+
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := &HelloResult{}
+	err = Exec(ctx, address, "Greeter.Hello", &HelloParams{Message: "bob"}, result, nil)
+	require.NoError(t, err)
+	require.Equal(t, "hello, bob", result.Message)
+
+	err = Exec(ctx, address, "Greeter.Raw", &HelloParams{}, result, nil)
+	require.NoError(t, err)
+	require.Equal(t, "raw", result.Message)
+
+	err = Exec(ctx, address, "Greeter.Fail", &HelloParams{}, result, nil)
+	require.Error(t, err)
+	require.Equal(t, "failed", err.Error())
+
+	err = Exec(ctx, address, "Greeter.Helper", &HelloParams{}, result, nil)
+	require.Error(t, err)
+}
+
+func TestServiceRegisterNil(t *testing.T) {
+	serv := NewService()
+	var greeter *Greeter
+	require.EqualError(t, serv.Register(greeter), "register: receiver is a nil *dsrpc.Greeter")
+	require.EqualError(t, serv.Register(nil), "register: receiver is nil")
+	require.Error(t, serv.RegisterName("Greeter", greeter))
+	require.Error(t, serv.RegisterName("Greeter", nil))
+	require.Empty(t, serv.handlers)
+}
@@ -19,9 +19,13 @@ func NewEmptyParams() *EmptyParams {
 }
 
 type Request struct {
-	Method string `json:"method"            msgpack:"method"`
-	Params any    `json:"params,omitempty"  msgpack:"params"`
-	Auth   *Auth  `json:"auth,omitempty"    msgpack:"auth"`
+	Method string   `json:"method"            msgpack:"method"`
+	Params any      `json:"params,omitempty"  msgpack:"params"`
+	Auth   *Auth    `json:"auth,omitempty"    msgpack:"auth"`
+	Meta   Metadata `json:"meta,omitempty"    msgpack:"meta,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty" msgpack:"attachments,omitempty"`
+	Range       *Range       `json:"range,omitempty"       msgpack:"range,omitempty"`
 }
 
 func NewEmptyRequest() *Request {
@@ -31,6 +35,23 @@ func NewEmptyRequest() *Request {
 	return req
 }
 
+// rawValue keeps an encoded block field, such as the request params,
+// until it is bound to its type. It holds the field bytes of the block
+// codec.
+type rawValue []byte
+
+func (raw rawValue) MarshalJSON() ([]byte, error) {
+	if len(raw) == 0 {
+		return []byte("null"), nil
+	}
+	return raw, nil
+}
+
+func (raw *rawValue) UnmarshalJSON(data []byte) error {
+	*raw = append((*raw)[0:0], data...)
+	return nil
+}
+
 func (req *Request) Pack() ([]byte, error) {
 	rBytes, err := encoder.Marshal(req)
 	return rBytes, err
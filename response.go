@@ -17,8 +17,14 @@ func NewEmptyResult() *EmptyResult {
 }
 
 type Response struct {
-	Error  string `json:"error"   msgpack:"error"`
-	Result any    `json:"result"  msgpack:"result"`
+	Error   string       `json:"error"             msgpack:"error"`
+	Fields  []FieldError `json:"fields,omitempty"  msgpack:"fields"`
+	Result  any          `json:"result"            msgpack:"result"`
+	Header  Metadata     `json:"header,omitempty"  msgpack:"header,omitempty"`
+	Trailer Metadata     `json:"trailer,omitempty" msgpack:"trailer,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty" msgpack:"attachments,omitempty"`
+	Range       *Range       `json:"range,omitempty"       msgpack:"range,omitempty"`
 }
 
 func NewEmptyResponse() *Response {
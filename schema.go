@@ -0,0 +1,180 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of JSON Schema used to describe method params
+// and results.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int64             `json:"minLength,omitempty"`
+	MaxLength            *int64             `json:"maxLength,omitempty"`
+	MinItems             *int64             `json:"minItems,omitempty"`
+	MaxItems             *int64             `json:"maxItems,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+}
+
+var (
+	typeOfTime      = reflect.TypeOf(time.Time{})
+	typeOfRawJson   = reflect.TypeOf(json.RawMessage{})
+	typeOfMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// SchemaOf returns the JSON Schema of the value type as it is encoded by
+// encoding/json.
+func SchemaOf(value any) *Schema {
+	if value == nil {
+		return &Schema{}
+	}
+	return schemaOfType(reflect.TypeOf(value), make(map[reflect.Type]bool))
+}
+
+func schemaOfType(rtype reflect.Type, seen map[reflect.Type]bool) *Schema {
+	for rtype.Kind() == reflect.Pointer {
+		rtype = rtype.Elem()
+	}
+	switch {
+	case rtype == typeOfTime:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rtype == typeOfRawJson:
+		return &Schema{}
+	case rtype.Implements(typeOfMarshaler), reflect.PointerTo(rtype).Implements(typeOfMarshaler):
+		return &Schema{}
+	}
+
+	switch rtype.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if rtype.Elem().Kind() == reflect.Uint8 && rtype.Kind() == reflect.Slice {
+			return &Schema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &Schema{Type: "array", Items: schemaOfType(rtype.Elem(), seen)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOfType(rtype.Elem(), seen)}
+	case reflect.Struct:
+		if seen[rtype] {
+			return &Schema{Type: "object"}
+		}
+		seen[rtype] = true
+		defer delete(seen, rtype)
+
+		schema := &Schema{
+			Type:       "object",
+			Properties: make(map[string]*Schema),
+		}
+		schemaOfFields(schema, rtype, seen)
+		if len(schema.Properties) == 0 {
+			schema.Properties = nil
+		}
+		return schema
+	}
+	return &Schema{}
+}
+
+func schemaOfFields(schema *Schema, rtype reflect.Type, seen map[reflect.Type]bool) {
+	for i := 0; i < rtype.NumField(); i++ {
+		field := rtype.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			ftype := field.Type
+			if ftype.Kind() == reflect.Pointer {
+				ftype = ftype.Elem()
+			}
+			if ftype.Kind() == reflect.Struct {
+				schemaOfFields(schema, ftype, seen)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property := schemaOfType(field.Type, seen)
+		for _, rule := range parseRules(field.Tag.Get("validate")) {
+			if rule.name == "required" {
+				schema.Required = append(schema.Required, name)
+				continue
+			}
+			property.applyRule(rule)
+		}
+		schema.Properties[name] = property
+	}
+}
+
+// applyRule maps a validate tag rule to the schema keywords.
+func (schema *Schema) applyRule(rule rule) {
+	switch rule.name {
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(rule.arg, 64)
+		if err != nil {
+			return
+		}
+		count := int64(limit)
+		switch schema.Type {
+		case "integer", "number":
+			if rule.name != "max" {
+				schema.Minimum = &limit
+			}
+			if rule.name != "min" {
+				schema.Maximum = &limit
+			}
+		case "string":
+			if rule.name != "max" {
+				schema.MinLength = &count
+			}
+			if rule.name != "min" {
+				schema.MaxLength = &count
+			}
+		case "array":
+			if rule.name != "max" {
+				schema.MinItems = &count
+			}
+			if rule.name != "min" {
+				schema.MaxItems = &count
+			}
+		}
+	case "oneof":
+		for _, option := range strings.Fields(rule.arg) {
+			number, err := strconv.ParseFloat(option, 64)
+			if err == nil && (schema.Type == "integer" || schema.Type == "number") {
+				schema.Enum = append(schema.Enum, number)
+				continue
+			}
+			schema.Enum = append(schema.Enum, option)
+		}
+	case "regexp":
+		schema.Pattern = rule.arg
+	}
+}
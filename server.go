@@ -12,14 +12,13 @@ import (
 	"net"
 	"sync"
 	"time"
-
-	encoder "encoding/json"
 )
 
 type HandlerFunc = func(*Content) error
 
 type Service struct {
 	handlers  map[string]HandlerFunc
+	infos     map[string]*MethodInfo
 	ctx       context.Context
 	cancel    context.CancelFunc
 	wg        *sync.WaitGroup
@@ -28,11 +27,25 @@ type Service struct {
 	keepalive bool
 	kaTime    time.Duration
 	kaMtx     sync.Mutex
+	strict    bool
+	zipMin    int64
+	lsMtx     sync.Mutex
+	listeners []net.Listener
+	batchMax  int
+	batchRuns int
+	upIdle    time.Duration
+	blockMax  int64
 }
 
 func NewService() *Service {
 	rdrpc := &Service{}
 	rdrpc.handlers = make(map[string]HandlerFunc)
+	rdrpc.infos = make(map[string]*MethodInfo)
+	rdrpc.zipMin = DefaultCompressThreshold
+	rdrpc.batchMax = DefaultMaxBatchSize
+	rdrpc.batchRuns = DefaultBatchParallelism
+	rdrpc.upIdle = DefaultUploadIdleTimeout
+	rdrpc.blockMax = DefaultMaxBlockSize
 	ctx, cancel := context.WithCancel(context.Background())
 	rdrpc.ctx = ctx
 	rdrpc.cancel = cancel
@@ -52,8 +65,15 @@ func (svc *Service) PostMiddleware(mw HandlerFunc) {
 	svc.postMw = append(svc.postMw, mw)
 }
 
-func (svc *Service) Handler(method string, handler HandlerFunc) {
+func (svc *Service) Handler(method string, handler HandlerFunc, opts ...MethodOption) {
 	svc.handlers[method] = handler
+	info := &MethodInfo{
+		Name: method,
+	}
+	for _, opt := range opts {
+		opt(info)
+	}
+	svc.infos[method] = info
 }
 
 func (svc *Service) SetKeepAlive(flag bool) {
@@ -68,13 +88,30 @@ func (svc *Service) SetKeepAlivePeriod(interval time.Duration) {
 	svc.kaTime = interval
 }
 
+// SetStrictParams makes BindParams reject JSON params with unknown fields.
+func (svc *Service) SetStrictParams(flag bool) {
+	svc.strict = flag
+}
+
+// SetCompressThreshold sets the size below which the response block and
+// binary data are sent uncompressed.
+func (svc *Service) SetCompressThreshold(size int64) {
+	svc.zipMin = size
+}
+
+// SetMaxBlockSize sets the largest size of a request block, as received
+// and decompressed, so that a block header can not exhaust the memory.
+func (svc *Service) SetMaxBlockSize(size int64) {
+	svc.blockMax = size
+}
+
 func (svc *Service) Listen(address string) error {
 	var err error
 	logInfo("server listen:", address)
 
 	addr, err := net.ResolveTCPAddr("tcp", address)
 	if err != nil {
-		err = fmt.Errorf("unable to resolve adddress: %s", err)
+		err = fmt.Errorf("unable to resolve address: %s", err)
 		return err
 	}
 	listener, err := net.ListenTCP("tcp", addr)
@@ -82,23 +119,74 @@ func (svc *Service) Listen(address string) error {
 		err = fmt.Errorf("unable to start listener: %s", err)
 		return err
 	}
+	return svc.Serve(listener)
+}
+
+// Serve accepts the connections of the listener until the service is
+// stopped. The listener is closed by Stop.
+func (svc *Service) Serve(listener net.Listener) error {
+	var err error
+	svc.lsMtx.Lock()
+	if svc.ctx.Err() != nil {
+		svc.lsMtx.Unlock()
+		listener.Close()
+		return err
+	}
+	svc.listeners = append(svc.listeners, listener)
+	svc.lsMtx.Unlock()
 
+	var delay time.Duration
 	for {
-		conn, err := listener.AcceptTCP()
+		conn, err := listener.Accept()
+		if svc.ctx.Err() != nil {
+			if conn != nil {
+				conn.Close()
+			}
+			return nil
+		}
+		if errors.Is(err, net.ErrClosed) {
+			return err
+		}
 		if err != nil {
+			// A failing accept, such as on too many open files, is
+			// retried with a growing delay.
 			logError("conn accept err:", err)
+			delay = acceptDelay(delay)
+			select {
+			case <-time.After(delay):
+			case <-svc.ctx.Done():
+			}
+			continue
 		}
-		select {
-		case <-svc.ctx.Done():
-			return err
-		default:
+		delay = 0
+		// The handler is counted under the lock, so that Stop waits
+		// for each accepted connection.
+		svc.lsMtx.Lock()
+		if svc.ctx.Err() != nil {
+			svc.lsMtx.Unlock()
+			conn.Close()
+			return nil
 		}
 		svc.wg.Add(1)
+		svc.lsMtx.Unlock()
 		go svc.handleConn(conn, svc.wg)
 	}
 	return err
 }
 
+// acceptDelay returns the delay before the next accept after a failed
+// accept, which doubles from 5ms up to a second.
+func acceptDelay(delay time.Duration) time.Duration {
+	if delay == 0 {
+		return 5 * time.Millisecond
+	}
+	delay *= 2
+	if delay > time.Second {
+		delay = time.Second
+	}
+	return delay
+}
+
 func notFound(content *Content) error {
 	execErr := errors.New("method not found")
 	err := content.SendError(execErr)
@@ -110,25 +198,35 @@ func (svc *Service) Stop() error {
 	// Disable new connection
 	logInfo("cancel rpc accept loop")
 	svc.cancel()
+	svc.lsMtx.Lock()
+	for _, listener := range svc.listeners {
+		listener.Close()
+	}
+	svc.listeners = nil
+	svc.lsMtx.Unlock()
 	// Wait handlers
 	logInfo("wait rpc handlers")
 	svc.wg.Wait()
 	return err
 }
 
-func (svc *Service) handleConn(conn *net.TCPConn, wg *sync.WaitGroup) {
+func (svc *Service) handleConn(conn net.Conn, wg *sync.WaitGroup) {
 	var err error
+	defer wg.Done()
 
-	if svc.keepalive {
-		err = conn.SetKeepAlive(true)
+	tcpConn, isTcp := conn.(*net.TCPConn)
+	if svc.keepalive && isTcp {
+		err = tcpConn.SetKeepAlive(true)
 		if err != nil {
 			err = fmt.Errorf("unable to set keepalive: %s", err)
+			conn.Close()
 			return
 		}
 		if svc.kaTime > 0 {
-			err = conn.SetKeepAlivePeriod(svc.kaTime)
+			err = tcpConn.SetKeepAlivePeriod(svc.kaTime)
 			if err != nil {
 				err = fmt.Errorf("unable to set keepalive period: %s", err)
+				conn.Close()
 				return
 			}
 		}
@@ -138,13 +236,16 @@ func (svc *Service) handleConn(conn *net.TCPConn, wg *sync.WaitGroup) {
 	remoteAddr := conn.RemoteAddr().String()
 	remoteHost, _, _ := net.SplitHostPort(remoteAddr)
 	content.remoteHost = remoteHost
+	content.strict = svc.strict
+	content.zipMin = svc.zipMin
+	content.blockMax = svc.blockMax
 
 	content.binReader = conn
 	content.binWriter = io.Discard
 
 	exitFunc := func() {
+		content.closeContext()
 		conn.Close()
-		wg.Done()
 		if err != nil {
 			logError("conn handler err:", err)
 		}
@@ -161,35 +262,66 @@ func (svc *Service) handleConn(conn *net.TCPConn, wg *sync.WaitGroup) {
 
 	err = content.ReadRequest()
 	if err != nil {
-		err = err
+		content.SendError(err)
 		return
 	}
 
 	err = content.BindMethod()
 	if err != nil {
-		err = err
+		content.SendError(err)
 		return
 	}
+	err = content.setContext(context.Background())
+	if err != nil {
+		content.SendError(err)
+		return
+	}
+	err = content.acceptDigest()
+	if err != nil {
+		content.SendError(err)
+		return
+	}
+	content.acceptCompression()
+	deadline, ok := content.ctx.Deadline()
+	if ok {
+		conn.SetDeadline(deadline)
+	}
+	content.watch = true
+	// The client of a notification does not wait for the end of the call.
+	if content.reqHeader.binSize == 0 && !content.reqHeader.hasFlag(flagStream|flagNotify) {
+		content.watchConn()
+	}
+	if content.reqHeader.hasFlag(flagBatch) {
+		err = svc.serveBatch(content)
+		return
+	}
+	err = svc.serve(content)
+	return
+}
+
+// serve runs the middleware and the handler of the call.
+func (svc *Service) serve(content *Content) error {
+	var err error
 	for _, mw := range svc.preMw {
 		err = mw(content)
 		if err != nil {
-			err = err
-			return
+			content.SendError(err)
+			return err
 		}
 	}
 	err = svc.Route(content)
+	content.finishTrailer(err)
 	if err != nil {
-		err = err
-		return
+		content.SendError(err)
+		return err
 	}
 	for _, mw := range svc.postMw {
 		err = mw(content)
 		if err != nil {
-			err = err
-			return
+			return err
 		}
 	}
-	return
+	return err
 }
 
 func (svc *Service) Route(content *Content) error {
@@ -211,59 +343,208 @@ func (content *Content) ReadRequest() error {
 	if err != nil {
 		return err
 	}
+	if content.reqHeader.frameKind() != frameCall {
+		err = errors.New("unexpected frame")
+		return err
+	}
+	if content.reqHeader.binSize < 0 && content.reqHeader.binSize != ChunkedSize {
+		err = errors.New("wrong binary size")
+		return err
+	}
+	if content.reqHeader.hasFlag(flagStream) && content.reqHeader.binSize != 0 {
+		err = errors.New("binary data in message stream")
+		return err
+	}
+	if content.reqHeader.hasFlag(flagNotify) {
+		if content.reqHeader.binSize != 0 || content.reqHeader.hasFlag(flagStream) {
+			err = errors.New("binary data in notification")
+			return err
+		}
+		// Nothing is sent back for a notification.
+		content.sockWriter = io.Discard
+	}
+	if content.reqHeader.hasFlag(flagBatch) {
+		if content.reqHeader.binSize != 0 || content.reqHeader.hasFlag(flagStream|flagNotify) {
+			err = errors.New("binary data in batch")
+			return err
+		}
+	}
+	if content.reqHeader.hasFlag(flagCallback) {
+		content.replies = make(chan *Packet, 1)
+	}
 
 	rpcSize := content.reqHeader.rpcSize
-	content.reqPacket.rcpPayload, err = ReadBytes(content.sockReader, rpcSize)
+	content.reqPacket.rcpPayload, err = readBlock(content.sockReader, rpcSize, content.blockMax)
+	if err != nil {
+		return err
+	}
+	content.reqPacket.rcpPayload, err = unzipBlock(content.reqHeader, content.reqPacket.rcpPayload, content.blockMax)
+	if err != nil {
+		return err
+	}
+	content.reqRpcRaw = int64(len(content.reqPacket.rcpPayload))
+	if content.reqHeader.binZipId() != 0 {
+		_, err = compressorById(content.reqHeader.binZipId())
+		if err != nil {
+			return err
+		}
+	}
+	codec, err := codecById(content.reqHeader.codecId())
 	if err != nil {
 		return err
 	}
+	content.codec = codec
 	return err
 }
 
+// BinWriter returns the writer of the response binary data. It is
+// valid once the result is sent.
 func (content *Content) BinWriter() io.Writer {
-	return content.sockWriter
+	if !content.resSent {
+		return content.sockWriter
+	}
+	return content.binStream()
+}
+
+// binStream returns the writer of the response binary data, which must
+// be closed to end chunked or compressed data.
+func (content *Content) binStream() io.WriteCloser {
+	if content.binOutput != nil {
+		return content.binOutput
+	}
+	writer, err := binOutputOf(content.resHeader, content.sockWriter, &content.resBinWire)
+	if err != nil {
+		writer = nopWriteCloser{content.sockWriter}
+	}
+	if content.resHash != nil {
+		writer = &hashWriter{writer: writer, hash: content.resHash}
+	}
+	content.binOutput = writer
+	return content.binOutput
 }
 
+// BinReader returns the reader of the request binary data. For chunked
+// data it returns the decoded data up to the end of the stream.
 func (content *Content) BinReader() io.Reader {
-	return content.sockReader
+	if content.binInput != nil {
+		return content.binInput
+	}
+	content.binInput, _ = binInputOf(content.reqHeader, content.sockReader, &content.reqBinWire)
+	if content.reqHeader.hasFlag(flagTrailer) {
+		content.binInput = &trailerReader{
+			content: content,
+			reader:  content.binInput,
+			remains: content.reqHeader.binSize,
+		}
+	}
+	return content.binInput
 }
 
+// BinSize returns the size of the request binary data, or ChunkedSize
+// for data of unknown length.
 func (content *Content) BinSize() int64 {
 	return content.reqHeader.binSize
 }
 
+// ReadBin copies the binary data of the request to writer. The copy
+// breaks when ctx or the request context is done.
 func (content *Content) ReadBin(ctx context.Context, writer io.Writer) error {
 	var err error
-	_, err = CopyBytes(ctx, content.sockReader, writer, content.reqHeader.binSize)
+	ctx, cancel := joinContext(ctx, content.Context())
+	defer cancel()
+	_, err = CopyBytes(ctx, content.BinReader(), writer, content.reqHeader.binSize)
+	if err != nil {
+		return err
+	}
+	content.watchConn()
 	return err
 }
 
+// BindMethod decodes the request block. The params are kept encoded
+// until BindParams, which decodes them into the params of the handler.
 func (content *Content) BindMethod() error {
 	var err error
-	err = encoder.Unmarshal(content.reqPacket.rcpPayload, content.reqBlock)
-	return err
+	content.reqBlock.Params = &content.reqParams
+	err = content.codec.Unmarshal(content.reqPacket.rcpPayload, content.reqBlock)
+	content.reqBlock.Params = NewEmptyParams()
+	if err != nil {
+		return err
+	}
+	return checkAttachments(content.reqBlock.Attachments, content.reqHeader.binSize)
 }
 
+// BindParams decodes the request params into params and checks them
+// against their validate tags. A *ValidationError is sent back to the
+// client by the service if the handler returns it.
 func (content *Content) BindParams(params any) error {
 	var err error
 	content.reqBlock.Params = params
-	err = encoder.Unmarshal(content.reqPacket.rcpPayload, content.reqBlock)
+	codec := content.codec
+	if content.strict && codec.Id() == jsonCodecId {
+		codec = StrictJsonCodec
+	}
+	if len(content.reqParams) > 0 {
+		err = codec.Unmarshal(content.reqParams, params)
+		if err != nil {
+			return unknownFieldError(err)
+		}
+	}
+	err = Validate(params)
 	if err != nil {
 		return err
 	}
 	return err
 }
 
+// unknownFieldError reports an unknown field of the params as a field
+// error of the params.
+func unknownFieldError(err error) error {
+	var ferr *UnknownFieldError
+	if !errors.As(err, &ferr) {
+		return err
+	}
+	field := FieldError{
+		Field:   ferr.Field,
+		Rule:    "unknown",
+		Message: "unknown field",
+	}
+	return &ValidationError{Fields: []FieldError{field}}
+}
+
 func (content *Content) SendResult(result any, binSize int64) error {
 	var err error
+	if content.inBatch && binSize != 0 {
+		err = errors.New("binary data in batch")
+		return err
+	}
+	if content.inCallback && binSize != 0 {
+		err = errors.New("binary data in callback")
+		return err
+	}
+	content.resSent = true
 	content.resBlock.Result = result
+	if content.inBatch {
+		// The result is sent with the replies of the batch.
+		return err
+	}
 
-	content.resPacket.rcpPayload, err = content.resBlock.Pack()
+	if content.resHash != nil && binSize != 0 && !content.resHeader.hasFlag(flagTrailer) {
+		// The trailer carries the digest of the binary data.
+		content.resHeader.setFlag(flagTrailer)
+		content.autoTrailer = true
+	}
+	if binSize > 0 && content.resHeader.hasFlag(flagTrailer) {
+		// The data before the trailer is chunked, so that a handler
+		// which fails in the middle of the data can end it early.
+		binSize = ChunkedSize
+	}
+	content.resHeader.setCodecId(content.codec.Id())
+	content.resHeader.binSize = binSize
+	content.setBinZip(content.resHeader)
+	err = content.packResponse()
 	if err != nil {
 		return err
 	}
-	content.resHeader.rpcSize = int64(len(content.resPacket.rcpPayload))
-	content.resHeader.binSize = binSize
 
 	content.resPacket.header, err = content.resHeader.Pack()
 	if err != nil {
@@ -280,17 +561,77 @@ func (content *Content) SendResult(result any, binSize int64) error {
 	return err
 }
 
+// packResponse encodes the response block, compressing a large one.
+func (content *Content) packResponse() error {
+	var err error
+	payload, err := content.codec.Marshal(content.resBlock)
+	if err != nil {
+		return err
+	}
+	content.resRpcRaw = int64(len(payload))
+	content.resPacket.rcpPayload, err = content.zipBlock(content.resHeader, payload)
+	if err != nil {
+		return err
+	}
+	content.resHeader.rpcSize = int64(len(content.resPacket.rcpPayload))
+	return err
+}
+
+// SendResultChunked sends the result and returns the writer of the
+// response binary data of unknown length. The data ends when the writer
+// is closed.
+func (content *Content) SendResultChunked(result any) (io.WriteCloser, error) {
+	var err error
+	err = content.SendResult(result, ChunkedSize)
+	if err != nil {
+		return nil, err
+	}
+	return content.binStream(), err
+}
+
+// sendReturn sends the values returned by a typed handler unless the
+// handler has already responded itself.
+func (content *Content) sendReturn(result any, execErr error) error {
+	var err error
+	if execErr != nil {
+		if !content.resSent {
+			content.SendError(execErr)
+		}
+		return execErr
+	}
+	if content.resSent {
+		return err
+	}
+	if result == nil {
+		result = NewEmptyResult()
+	}
+	return content.SendResult(result, 0)
+}
+
+// SendError sends the error to the client. It does nothing if a result
+// or an error has already been sent.
 func (content *Content) SendError(execErr error) error {
 	var err error
+	if content.resSent {
+		return err
+	}
+	content.resSent = true
 
 	content.resBlock.Error = execErr.Error()
+	var verr *ValidationError
+	if errors.As(execErr, &verr) {
+		content.resBlock.Fields = verr.Fields
+	}
 	content.resBlock.Result = NewEmptyResult()
+	if content.inBatch {
+		return err
+	}
 
-	content.resPacket.rcpPayload, err = content.resBlock.Pack()
+	content.resHeader.setCodecId(content.codec.Id())
+	err = content.packResponse()
 	if err != nil {
 		return err
 	}
-	content.resHeader.rpcSize = int64(len(content.resPacket.rcpPayload))
 	content.resPacket.header, err = content.resHeader.Pack()
 	if err != nil {
 		return err
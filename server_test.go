@@ -0,0 +1,139 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// startService serves the service on a free local port and returns its
+// address. The listener is open on return, so the service accepts calls
+// at once, and the service is stopped at the end of the test.
+func startService(t testing.TB, serv *Service) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	done := make(chan error, 1)
+	go func() {
+		done <- serv.Serve(listener)
+	}()
+	t.Cleanup(func() {
+		serv.Stop()
+		require.NoError(t, <-done)
+	})
+	return listener.Addr().String()
+}
+
+func TestServiceStop(t *testing.T) {
+	serv := NewService()
+	serv.Handler(HelloMethod, helloHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := Exec(ctx, address, HelloMethod, &HelloParams{Message: "hi"}, &HelloResult{}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, serv.Stop())
+	err = Exec(ctx, address, HelloMethod, &HelloParams{Message: "hi"}, &HelloResult{}, nil)
+	require.Error(t, err)
+}
+
+// failingListener fails each accept, as a listener out of file
+// descriptors.
+type failingListener struct {
+	net.Listener
+	accepts atomic.Int32
+}
+
+func (listener *failingListener) Accept() (net.Conn, error) {
+	listener.accepts.Add(1)
+	return nil, errors.New("too many open files")
+}
+
+func TestServeAcceptDelay(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener := &failingListener{Listener: inner}
+	serv := NewService()
+	done := make(chan error, 1)
+	go func() {
+		done <- serv.Serve(listener)
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, serv.Stop())
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("service is not stopped")
+	}
+	// 5, 10, 20, 40 and 80ms delays fit in 200ms.
+	require.Less(t, listener.accepts.Load(), int32(10))
+	require.Equal(t, time.Second, acceptDelay(800*time.Millisecond))
+
+	// A listener closed outside the service ends the serve.
+	inner, err = net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serv = NewService()
+	go func() {
+		done <- serv.Serve(inner)
+	}()
+	inner.Close()
+	select {
+	case err = <-done:
+		require.ErrorIs(t, err, net.ErrClosed)
+	case <-time.After(time.Second):
+		t.Fatal("serve is not ended")
+	}
+}
+
+// rawJsonCodec is a JSON codec with an id unknown to the service.
+type rawJsonCodec struct {
+	jsonCodec
+}
+
+func (codec rawJsonCodec) Id() byte {
+	return 9
+}
+
+func TestServeErrors(t *testing.T) {
+	serv := NewService()
+	serv.PreMiddleware(func(content *Content) error {
+		if content.Metadata().Get("deny") == "yes" {
+			return errors.New("access denied")
+		}
+		return nil
+	})
+	serv.Handler(HelloMethod, helloHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The errors before the handler are sent to the client, which
+	// otherwise sees only the closed connection.
+	params := &HelloParams{Message: "hi"}
+	err := Exec(ctx, address, HelloMethod, params, &HelloResult{}, nil,
+		WithMetadata(NewMetadata("deny", "yes")))
+	require.EqualError(t, err, "access denied")
+
+	err = Exec(ctx, address, HelloMethod, params, &HelloResult{}, nil,
+		WithCodec(rawJsonCodec{}))
+	require.EqualError(t, err, "unsupported codec 9")
+
+	err = Exec(ctx, address, "unknown", params, &HelloResult{}, nil)
+	require.EqualError(t, err, "method not found")
+
+	err = Exec(ctx, address, HelloMethod, params, &HelloResult{}, nil)
+	require.NoError(t, err)
+}
@@ -0,0 +1,496 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// Stream is a sequence of messages of a streaming call. A server stream
+// follows the head result of the response, a client stream follows the
+// request, and a bidirectional call has both. The sender ends its side
+// with an optional error, which the receiver gets from Recv. Send and
+// Recv can run in two goroutines, each of them is used by one goroutine
+// at a time.
+type Stream struct {
+	content  *Content
+	ctx      context.Context
+	server   bool
+	conn     net.Conn
+	stop     func()
+	once     sync.Once
+	canSend  bool
+	sendDone bool
+	headRead bool
+	closed   chan struct{}
+	closeErr error
+	closing  sync.Once
+	mutex    sync.Mutex
+	done     bool
+	err      error
+}
+
+// serverStream returns the stream of the call on the server.
+func (content *Content) serverStream() *Stream {
+	if content.stream == nil {
+		content.stream = &Stream{
+			content: content,
+			ctx:     content.Context(),
+			server:  true,
+			closed:  make(chan struct{}),
+		}
+	}
+	return content.stream
+}
+
+// SendStream sends the head result of a server-streaming or bidirectional
+// call and returns the stream for the messages. The stream ends with the
+// error returned by the handler if it is not closed before.
+func (content *Content) SendStream(result any) (*Stream, error) {
+	var err error
+	if content.resSent {
+		err = errors.New("response already sent")
+		return nil, err
+	}
+	if content.inBatch {
+		err = errors.New("message stream in batch")
+		return nil, err
+	}
+	if content.inCallback {
+		err = errors.New("message stream in callback")
+		return nil, err
+	}
+	content.resHeader.setFlag(flagStream)
+	content.resHeader.setFlag(flagTrailer)
+	content.autoTrailer = true
+	err = content.SendResult(result, 0)
+	if err != nil {
+		return nil, err
+	}
+	stream := content.serverStream()
+	stream.canSend = true
+	return stream, err
+}
+
+// RecvStream returns the stream of the messages sent by the client of a
+// client-streaming or bidirectional call.
+func (content *Content) RecvStream() (*Stream, error) {
+	var err error
+	if !content.reqHeader.hasFlag(flagStream) {
+		err = errors.New("request is not a stream")
+		return nil, err
+	}
+	return content.serverStream(), err
+}
+
+// OpenStream calls a server-streaming method. The head result is decoded
+// into result and the messages are received with Recv. The stream must be
+// closed.
+func OpenStream(ctx context.Context, address string, method string, param, result any, auth *Auth, opts ...CallOption) (*Stream, error) {
+	var err error
+
+	conn, err := dial(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := ConnOpenStream(ctx, conn, method, param, result, auth, opts...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	stream.conn = conn
+	return stream, err
+}
+
+// ConnOpenStream is OpenStream over an established connection, which
+// can not be used for other calls until the end of the stream.
+func ConnOpenStream(ctx context.Context, conn net.Conn, method string, param, result any, auth *Auth, opts ...CallOption) (*Stream, error) {
+	var err error
+	stream, err := openStream(ctx, conn, false, method, param, result, auth, opts)
+	if err != nil {
+		return nil, err
+	}
+	stream.content.inputDone.Store(true)
+	err = stream.readHead()
+	if err != nil {
+		return nil, err
+	}
+	return stream, err
+}
+
+// OpenBidiStream calls a client-streaming or bidirectional method. The
+// messages are sent with Send, and CloseSend ends them. The head result
+// is decoded into result with the first Recv, or with CloseAndRecv for
+// a client-streaming method. The stream must be closed.
+func OpenBidiStream(ctx context.Context, address string, method string, param, result any, auth *Auth, opts ...CallOption) (*Stream, error) {
+	var err error
+
+	conn, err := dial(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := ConnOpenBidiStream(ctx, conn, method, param, result, auth, opts...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	stream.conn = conn
+	return stream, err
+}
+
+// ConnOpenBidiStream is OpenBidiStream over an established connection,
+// which can not be used for other calls until the end of the stream.
+func ConnOpenBidiStream(ctx context.Context, conn net.Conn, method string, param, result any, auth *Auth, opts ...CallOption) (*Stream, error) {
+	return openStream(ctx, conn, true, method, param, result, auth, opts)
+}
+
+func openStream(ctx context.Context, conn net.Conn, send bool, method string, param, result any, auth *Auth, opts []CallOption) (*Stream, error) {
+	var err error
+
+	content := CreateContent(conn)
+	content.applyOptions(opts)
+	content.reqBlock.Method = method
+	if param != nil {
+		content.reqBlock.Params = param
+	}
+	if auth != nil {
+		content.reqBlock.Auth = auth
+	}
+	if result != nil {
+		content.resBlock.Result = result
+	}
+	if send {
+		content.reqHeader.setFlag(flagStream)
+	}
+
+	err = content.createRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stream := &Stream{
+		content: content,
+		ctx:     ctx,
+		canSend: send,
+		stop:    content.watchContext(ctx, conn),
+		closed:  make(chan struct{}),
+	}
+	err = content.writeRequest()
+	if err != nil {
+		return nil, stream.end(err)
+	}
+	return stream, err
+}
+
+// readHead reads the head response of the call on the client.
+func (stream *Stream) readHead() error {
+	var err error
+	if stream.headRead {
+		return err
+	}
+	stream.headRead = true
+	content := stream.content
+	err = content.readResponse()
+	if err != nil {
+		return stream.end(err)
+	}
+	err = content.bindResponse()
+	if err != nil {
+		return stream.end(err)
+	}
+	if !content.resHeader.hasFlag(flagStream) {
+		// The method has sent a plain result.
+		err = content.readTrailer()
+		return stream.end(err)
+	}
+	return err
+}
+
+// Context returns the context of the stream.
+func (stream *Stream) Context() context.Context {
+	return stream.ctx
+}
+
+// Send sends a message of the stream.
+func (stream *Stream) Send(msg any) error {
+	var err error
+	content := stream.content
+	if !stream.canSend {
+		err = errors.New("stream is receive only")
+		return err
+	}
+	if stream.sendDone {
+		err = errors.New("stream is closed")
+		return err
+	}
+	err = stream.ctx.Err()
+	if err != nil {
+		err = fmt.Errorf("break by context: %w", err)
+		return err
+	}
+	payload, err := content.codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	header := NewEmptyHeader()
+	header.setCodecId(content.codec.Id())
+	header.setFrameKind(frameMessage)
+	payload, err = content.zipBlock(header, payload)
+	if err != nil {
+		return err
+	}
+	return writeFrame(content.sockWriter, header, payload)
+}
+
+// Recv receives the next message of the stream into msg. It returns
+// io.EOF at the end of the stream, or the error the stream is ended with.
+func (stream *Stream) Recv(msg any) error {
+	var err error
+	content := stream.content
+	if stream.server && !content.reqHeader.hasFlag(flagStream) {
+		err = errors.New("stream is send only")
+		return err
+	}
+	if !stream.server {
+		err = stream.readHead()
+		if err != nil {
+			return err
+		}
+	}
+	done, err := stream.ended()
+	if done {
+		if err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	header, payload, err := readFrame(content.sockReader, content.blockMax)
+	if err != nil {
+		if stream.server && content.cancel != nil {
+			content.cancel()
+		}
+		return stream.end(err)
+	}
+	switch header.frameKind() {
+	case frameMessage:
+		err = unmarshalFrame(header, payload, msg, content.blockMax)
+		if err != nil {
+			return stream.end(err)
+		}
+		return err
+	case frameTrailer:
+		if stream.server {
+			err = stream.recvEnd(header, payload)
+		} else {
+			block := content.newTrailerBlock()
+			err = unmarshalFrame(header, payload, block, content.blockMax)
+			if err == nil {
+				err = content.bindTrailer(block)
+			}
+		}
+		err = stream.end(err)
+		if err != nil {
+			return err
+		}
+		return io.EOF
+	case frameCancel:
+		if stream.server && content.cancel != nil {
+			content.cancel()
+			return stream.end(ErrCanceled)
+		}
+	}
+	err = errors.New("unexpected frame")
+	return stream.end(err)
+}
+
+// recvEnd takes the end of the client messages on the server. Then the
+// connection is watched for the cancel of the call.
+func (stream *Stream) recvEnd(header *Header, payload []byte) error {
+	var err error
+	block := &Response{
+		Result: NewEmptyResult(),
+	}
+	err = unmarshalFrame(header, payload, block, stream.content.blockMax)
+	if err != nil {
+		return err
+	}
+	stream.content.watchConn()
+	if len(block.Error) > 0 {
+		err = errors.New(block.Error)
+		return err
+	}
+	return err
+}
+
+// end finishes the receiving side of the stream with the error. A stream
+// keeps the error it is ended with first.
+func (stream *Stream) end(err error) error {
+	stream.mutex.Lock()
+	if !stream.done {
+		stream.done = true
+		stream.err = contextError(stream.ctx, err)
+	}
+	err = stream.err
+	stream.mutex.Unlock()
+	stream.once.Do(func() {
+		if stream.stop != nil {
+			stream.stop()
+		}
+	})
+	return err
+}
+
+// ended reports whether the receiving side of the stream is finished and
+// returns its error.
+func (stream *Stream) ended() (bool, error) {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	return stream.done, stream.err
+}
+
+// Err returns the error the stream is ended with, it is nil for a stream
+// ended successfully.
+func (stream *Stream) Err() error {
+	_, err := stream.ended()
+	return err
+}
+
+// CloseSend ends the messages sent from this side of the stream.
+func (stream *Stream) CloseSend() error {
+	return stream.CloseWithError(nil)
+}
+
+// CloseWithError ends the messages sent from this side of the stream with
+// the error, which the other side gets from Recv.
+func (stream *Stream) CloseWithError(execErr error) error {
+	var err error
+	content := stream.content
+	if !stream.canSend {
+		err = errors.New("stream is receive only")
+		return err
+	}
+	if stream.sendDone {
+		return err
+	}
+	stream.sendDone = true
+	if stream.server {
+		return content.SendTrailer(nil, execErr)
+	}
+	block := &Response{
+		Result: NewEmptyResult(),
+	}
+	if execErr != nil {
+		block.Error = execErr.Error()
+	}
+	err = writeTrailerFrame(content.sockWriter, content.codec, block)
+	if err != nil {
+		return err
+	}
+	content.inputDone.Store(true)
+	return err
+}
+
+// CloseAndRecv ends the messages of a client-streaming call and receives
+// the result of the call.
+func (stream *Stream) CloseAndRecv() error {
+	var err error
+	// The server may have ended the call before the end of the messages,
+	// so its response is read anyway.
+	sendErr := stream.CloseSend()
+	err = stream.readHead()
+	if err != nil {
+		return err
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+	done, err := stream.ended()
+	if !done {
+		err = errors.New("response is a message stream")
+		return err
+	}
+	return err
+}
+
+// Close ends the stream. On the server the messages are ended without an
+// error. On the client a stream which is not received up to its end is
+// canceled, and the connection opened by OpenStream is closed. The
+// client side is closed once, further calls return the same error.
+func (stream *Stream) Close() error {
+	if stream.server {
+		return stream.CloseSend()
+	}
+	stream.closing.Do(func() {
+		done, _ := stream.ended()
+		if !done {
+			if stream.canSend && !stream.sendDone {
+				stream.sendDone = true
+				stream.content.inputDone.Store(true)
+			}
+			stream.content.sendCancel()
+			stream.end(ErrCanceled)
+		}
+		close(stream.closed)
+		if stream.conn != nil {
+			stream.closeErr = stream.conn.Close()
+		}
+	})
+	return stream.closeErr
+}
+
+// Messages receives the messages of the stream into the returned
+// channel, which is closed at the end of the stream or when the stream
+// is closed. The channel is not buffered, so the sender is held back by a
+// slow reader. The error the stream is ended with is returned by Err.
+func Messages[M any](stream *Stream) <-chan *M {
+	channel := make(chan *M)
+	go func() {
+		defer close(channel)
+		for {
+			msg := new(M)
+			err := stream.Recv(msg)
+			if err != nil {
+				return
+			}
+			select {
+			case channel <- msg:
+			case <-stream.ctx.Done():
+				stream.end(stream.ctx.Err())
+				return
+			case <-stream.closed:
+				return
+			}
+		}
+	}()
+	return channel
+}
+
+// TypedStream is a stream of messages of type S sent and of type R
+// received.
+type TypedStream[S, R any] struct {
+	*Stream
+}
+
+func NewTypedStream[S, R any](stream *Stream) TypedStream[S, R] {
+	return TypedStream[S, R]{Stream: stream}
+}
+
+func (stream TypedStream[S, R]) Send(msg *S) error {
+	return stream.Stream.Send(msg)
+}
+
+// Recv returns the next message, or io.EOF at the end of the stream.
+func (stream TypedStream[S, R]) Recv() (*R, error) {
+	msg := new(R)
+	err := stream.Stream.Recv(msg)
+	if err != nil {
+		return nil, err
+	}
+	return msg, err
+}
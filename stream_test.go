@@ -0,0 +1,323 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	listKeysMethod string = "listKeys"
+	tailLogMethod  string = "tailLog"
+)
+
+type ListParams struct {
+	Count int    `json:"count"`
+	Fail  string `json:"fail"`
+}
+
+type KeyMessage struct {
+	Key string `json:"key"`
+}
+
+func listKeysHandler(content *Content) error {
+	var err error
+	params := &ListParams{}
+	err = content.BindParams(params)
+	if err != nil {
+		return err
+	}
+	stream, err := content.SendStream(&HelloResult{Message: strconv.Itoa(params.Count)})
+	if err != nil {
+		return err
+	}
+	for i := 0; i < params.Count; i++ {
+		err = stream.Send(&KeyMessage{Key: fmt.Sprintf("key-%06d", i)})
+		if err != nil {
+			return err
+		}
+	}
+	if len(params.Fail) > 0 {
+		return errors.New(params.Fail)
+	}
+	return stream.Close()
+}
+
+var tailStopped = make(chan error, 1)
+
+// tailLogHandler sends messages until the call is canceled.
+func tailLogHandler(content *Content) error {
+	var err error
+	stream, err := content.SendStream(NewEmptyResult())
+	if err != nil {
+		return err
+	}
+	for {
+		err = stream.Send(&KeyMessage{Key: "line"})
+		if err != nil {
+			tailStopped <- err
+			return err
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestServerStream(t *testing.T) {
+	serv := NewService()
+	serv.Handler(listKeysMethod, listKeysHandler)
+	serv.Handler(tailLogMethod, tailLogHandler)
+	serv.Handler(HelloMethod, helloHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, opt := range []CallOption{WithCodec(JsonCodec), WithCodec(MsgpackCodec), WithCompression(FlateCompressor)} {
+		result := &HelloResult{}
+		stream, err := OpenStream(ctx, address, listKeysMethod, &ListParams{Count: 1000}, result, nil, opt)
+		require.NoError(t, err)
+		require.Equal(t, "1000", result.Message)
+		count := 0
+		for {
+			msg := &KeyMessage{}
+			err = stream.Recv(msg)
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			require.Equal(t, fmt.Sprintf("key-%06d", count), msg.Key)
+			count++
+		}
+		require.Equal(t, 1000, count)
+		require.NoError(t, stream.Err())
+		require.NoError(t, stream.Close())
+	}
+
+	// The stream ends with the handler error.
+	stream, err := OpenStream(ctx, address, listKeysMethod, &ListParams{Count: 3, Fail: "disk failure"}, nil, nil)
+	require.NoError(t, err)
+	count := 0
+	for msg := range Messages[KeyMessage](stream) {
+		require.NotEmpty(t, msg.Key)
+		count++
+	}
+	require.Equal(t, 3, count)
+	require.EqualError(t, stream.Err(), "disk failure")
+	stream.Close()
+
+	// A stream left early is closed while the messages are received.
+	stream, err = OpenStream(ctx, address, tailLogMethod, nil, nil, nil)
+	require.NoError(t, err)
+	channel := Messages[KeyMessage](stream)
+	for range channel {
+		break
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, stream.Close())
+		}()
+	}
+	wg.Wait()
+	for range channel {
+	}
+	require.ErrorIs(t, stream.Err(), ErrCanceled)
+	select {
+	case err = <-tailStopped:
+		require.Error(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler is not stopped")
+	}
+
+	// A plain method ends the stream at once.
+	result := &HelloResult{}
+	stream, err = OpenStream(ctx, address, HelloMethod, &HelloParams{Message: "hello"}, result, nil)
+	require.NoError(t, err)
+	require.Equal(t, io.EOF, stream.Recv(&KeyMessage{}))
+	stream.Close()
+
+	// A canceled call stops the handler.
+	tailCtx, tailCancel := context.WithCancel(ctx)
+	stream, err = OpenStream(tailCtx, address, tailLogMethod, nil, nil, nil)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, stream.Recv(&KeyMessage{}))
+	}
+	tailCancel()
+	for {
+		err = stream.Recv(&KeyMessage{})
+		if err != nil {
+			break
+		}
+	}
+	require.ErrorIs(t, err, context.Canceled)
+	stream.Close()
+	select {
+	case err = <-tailStopped:
+		require.Error(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler is not stopped")
+	}
+}
+
+const (
+	bulkInsertMethod string = "bulkInsert"
+	sessionMethod    string = "session"
+)
+
+type RowMessage struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type RowResult struct {
+	Id    int    `json:"id"`
+	Error string `json:"error"`
+}
+
+// bulkInsertHandler counts the rows of a client stream.
+func bulkInsertHandler(content *Content) error {
+	var err error
+	stream, err := content.RecvStream()
+	if err != nil {
+		return err
+	}
+	count := 0
+	for {
+		row := &RowMessage{}
+		err = stream.Recv(row)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		count++
+	}
+	return content.SendResult(&HelloResult{Message: strconv.Itoa(count)}, 0)
+}
+
+// sessionHandler answers each row with its result.
+func sessionHandler(content *Content) error {
+	var err error
+	stream, err := content.SendStream(NewEmptyResult())
+	if err != nil {
+		return err
+	}
+	rows := NewTypedStream[RowResult, RowMessage](stream)
+	for {
+		row, err := rows.Recv()
+		if err == io.EOF {
+			return rows.CloseSend()
+		}
+		if err != nil {
+			return err
+		}
+		result := &RowResult{Id: row.Id}
+		if len(row.Name) == 0 {
+			result.Error = "empty name"
+		}
+		err = rows.Send(result)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func TestClientStream(t *testing.T) {
+	serv := NewService()
+	serv.Handler(bulkInsertMethod, bulkInsertHandler)
+	serv.Handler(sessionMethod, sessionHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := &HelloResult{}
+	stream, err := OpenBidiStream(ctx, address, bulkInsertMethod, nil, result, nil,
+		WithCompression(GzipCompressor))
+	require.NoError(t, err)
+	for i := 0; i < 10000; i++ {
+		err = stream.Send(&RowMessage{Id: i, Name: "row"})
+		require.NoError(t, err)
+	}
+	err = stream.CloseAndRecv()
+	require.NoError(t, err)
+	require.Equal(t, "10000", result.Message)
+	require.NoError(t, stream.Close())
+
+	// The client ends its messages with an error.
+	stream, err = OpenBidiStream(ctx, address, bulkInsertMethod, nil, result, nil)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&RowMessage{Id: 1}))
+	err = stream.CloseWithError(errors.New("source failure"))
+	require.NoError(t, err)
+	err = stream.CloseAndRecv()
+	require.EqualError(t, err, "source failure")
+	stream.Close()
+
+	// Rows are sent and their results received at the same time.
+	stream, err = OpenBidiStream(ctx, address, sessionMethod, nil, nil, nil)
+	require.NoError(t, err)
+	session := NewTypedStream[RowMessage, RowResult](stream)
+	go func() {
+		for i := 0; i < 1000; i++ {
+			name := "row"
+			if i%10 == 0 {
+				name = ""
+			}
+			err := session.Send(&RowMessage{Id: i, Name: name})
+			if err != nil {
+				return
+			}
+		}
+		session.CloseSend()
+	}()
+	count, failed := 0, 0
+	for {
+		result, err := session.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.Equal(t, count, result.Id)
+		if len(result.Error) > 0 {
+			failed++
+		}
+		count++
+	}
+	require.Equal(t, 1000, count)
+	require.Equal(t, 100, failed)
+	require.NoError(t, session.Close())
+
+	// The session is canceled by the client.
+	stream, err = OpenBidiStream(ctx, address, sessionMethod, nil, nil, nil)
+	require.NoError(t, err)
+	session = NewTypedStream[RowMessage, RowResult](stream)
+	require.NoError(t, session.Send(&RowMessage{Id: 1, Name: "row"}))
+	_, err = session.Recv()
+	require.NoError(t, err)
+	require.NoError(t, session.Close())
+	_, err = session.Recv()
+	require.ErrorIs(t, err, context.Canceled)
+
+	// A plain method does not take a stream.
+	stream, err = OpenBidiStream(ctx, address, "unknown", nil, nil, nil)
+	require.NoError(t, err)
+	err = stream.CloseAndRecv()
+	require.Error(t, err)
+	stream.Close()
+}
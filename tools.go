@@ -11,12 +11,23 @@ import (
 	"io"
 )
 
+// readBlock reads a block of the size, which must not exceed limit, so
+// that a header can not make a large allocation.
+func readBlock(reader io.Reader, size, limit int64) ([]byte, error) {
+	if size < 0 || size > limit {
+		return nil, ErrBlockTooLarge
+	}
+	return ReadBytes(reader, size)
+}
+
 func ReadBytes(reader io.Reader, size int64) ([]byte, error) {
 	buffer := make([]byte, size)
 	read, err := io.ReadFull(reader, buffer)
 	return buffer[0:read], err
 }
 
+// CopyBytes copies dataSize bytes from reader to writer. A negative
+// dataSize copies until the end of reader.
 func CopyBytes(ctx context.Context, reader io.Reader, writer io.Writer, dataSize int64) (int64, error) {
 	var err error
 	var bSize int64 = 1024 * 16
@@ -27,7 +38,7 @@ func CopyBytes(ctx context.Context, reader io.Reader, writer io.Writer, dataSize
 	for {
 		select {
 		case <-ctx.Done():
-			return total, errors.New("break by context")
+			return total, fmt.Errorf("break by context: %w", ctx.Err())
 		default:
 		}
 
@@ -40,17 +51,26 @@ func CopyBytes(ctx context.Context, reader io.Reader, writer io.Writer, dataSize
 		if remains == 0 {
 			return total, err
 		}
-		if remains < bSize {
+		if remains >= 0 && remains < bSize {
 			bSize = remains
 		}
 		received, err := reader.Read(buffer[0:bSize])
+		if err == io.EOF && remains < 0 {
+			if received > 0 {
+				_, err = writer.Write(buffer[0:received])
+				total += int64(received)
+			} else {
+				err = nil
+			}
+			return total, err
+		}
 		if err != nil {
-			err = fmt.Errorf("read error: %v", err)
+			err = fmt.Errorf("read error: %w", err)
 			return total, err
 		}
 		recorded, err := writer.Write(buffer[0:received])
 		if err != nil {
-			err = fmt.Errorf("write error: %v", err)
+			err = fmt.Errorf("write error: %w", err)
 			return total, err
 		}
 		if recorded != received {
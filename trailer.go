@@ -0,0 +1,202 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"errors"
+	"io"
+)
+
+// EnableTrailer announces a trailer frame after the binary data of the
+// response. It must be called before the result is sent.
+func (content *Content) EnableTrailer() error {
+	var err error
+	if content.resSent {
+		err = errors.New("response already sent")
+		return err
+	}
+	if content.inCallback {
+		err = errors.New("trailer in callback")
+		return err
+	}
+	content.resHeader.setFlag(flagTrailer)
+	return err
+}
+
+func (content *Content) trailerPending() bool {
+	return content.resHeader.hasFlag(flagTrailer) && !content.trailerSent
+}
+
+// SendTrailer sends the trailer frame after the binary data. The client
+// merges the result into the result of the call and returns the error
+// as the error of the call. A chunked stream is closed first.
+func (content *Content) SendTrailer(result any, execErr error) error {
+	var err error
+	if !content.resSent {
+		err = errors.New("result is not sent")
+		return err
+	}
+	if !content.trailerPending() {
+		err = errors.New("trailer is not enabled or already sent")
+		return err
+	}
+	content.trailerSent = true
+	if content.binOutput != nil {
+		err = content.binOutput.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	block := &Response{
+		Result:  result,
+		Trailer: content.resDigestTrailer(content.resBlock.Trailer),
+	}
+	if result == nil {
+		block.Result = NewEmptyResult()
+	}
+	if execErr != nil {
+		block.Error = execErr.Error()
+		var verr *ValidationError
+		if errors.As(execErr, &verr) {
+			block.Fields = verr.Fields
+		}
+	}
+	return writeTrailerFrame(content.sockWriter, content.codec, block)
+}
+
+// finishTrailer sends the trailer left unsent by the handler, so that the
+// client never takes a broken download for a success.
+func (content *Content) finishTrailer(execErr error) {
+	if !content.resSent || !content.trailerPending() {
+		return
+	}
+	if execErr == nil && !content.autoTrailer {
+		execErr = errors.New("trailer is not sent")
+	}
+	content.SendTrailer(nil, execErr)
+}
+
+// readTrailer reads the trailer frame which follows the binary data of
+// the response and merges it into the result and the error of the call.
+func (content *Content) readTrailer() error {
+	var err error
+	if !content.resHeader.hasFlag(flagTrailer) {
+		return content.verifyResDigest("")
+	}
+	block := content.newTrailerBlock()
+	err = readTrailerFrame(content.sockReader, block, content.blockMax)
+	if err != nil {
+		return err
+	}
+	return content.bindTrailer(block)
+}
+
+// newTrailerBlock returns the block of the response trailer, which
+// decodes into the result of the call.
+func (content *Content) newTrailerBlock() *Response {
+	block := &Response{
+		Result: content.resBlock.Result,
+	}
+	if block.Result == nil {
+		block.Result = NewEmptyResult()
+	}
+	return block
+}
+
+// bindTrailer merges the trailer into the call and returns its error.
+func (content *Content) bindTrailer(block *Response) error {
+	var err error
+	digest := block.Trailer.Get(digestMetaKey)
+	block.Trailer.Delete(digestMetaKey)
+	content.resBlock.Trailer = content.resBlock.Trailer.merge(block.Trailer)
+	content.bindMetadata()
+	if len(block.Fields) > 0 {
+		err = &ValidationError{Fields: block.Fields}
+		return err
+	}
+	if len(block.Error) > 0 {
+		err = errors.New(block.Error)
+		return err
+	}
+	return content.verifyResDigest(digest)
+}
+
+// writeTrailerFrame writes a trailer frame with the block.
+func writeTrailerFrame(writer io.Writer, codec Codec, block *Response) error {
+	var err error
+	payload, err := codec.Marshal(block)
+	if err != nil {
+		return err
+	}
+	header := NewEmptyHeader()
+	header.setCodecId(codec.Id())
+	header.setFrameKind(frameTrailer)
+	return writeFrame(writer, header, payload)
+}
+
+// readTrailerFrame reads a trailer frame into the block.
+func readTrailerFrame(reader io.Reader, block *Response, limit int64) error {
+	var err error
+	header, payload, err := readFrame(reader, limit)
+	if err != nil {
+		return err
+	}
+	if header.frameKind() != frameTrailer {
+		err = errors.New("unexpected frame")
+		return err
+	}
+	return unmarshalFrame(header, payload, block, limit)
+}
+
+// writeFrame writes the header and the payload of a frame.
+func writeFrame(writer io.Writer, header *Header, payload []byte) error {
+	var err error
+	header.rpcSize = int64(len(payload))
+	headerBytes, err := header.Pack()
+	if err != nil {
+		return err
+	}
+	// The frame is written at once, so the frames written by several
+	// goroutines are not mixed up.
+	_, err = writer.Write(append(headerBytes, payload...))
+	if err != nil {
+		return err
+	}
+	return err
+}
+
+// readFrame reads the header and the payload of a frame. The payload is
+// limited to limit bytes.
+func readFrame(reader io.Reader, limit int64) (*Header, []byte, error) {
+	var err error
+	headerBytes, err := ReadBytes(reader, headerSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	header, err := UnpackHeader(headerBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	payload, err := readBlock(reader, header.rpcSize, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, payload, err
+}
+
+// unmarshalFrame decodes the payload of a frame into value.
+func unmarshalFrame(header *Header, payload []byte, value any, limit int64) error {
+	var err error
+	payload, err = unzipBlock(header, payload, limit)
+	if err != nil {
+		return err
+	}
+	codec, err := codecById(header.codecId())
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(payload, value)
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	trailerMethod     string = "trailer"
+	brokenMethod      string = "broken"
+	brokenSizedMethod string = "brokenSized"
+)
+
+type trailerResult struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	Sum  string `json:"sum"`
+}
+
+// trailerSum holds the fields of trailerResult known after the stream.
+type trailerSum struct {
+	Size int64  `json:"size"`
+	Sum  string `json:"sum"`
+}
+
+func trailerHandler(content *Content) error {
+	var err error
+	err = content.EnableTrailer()
+	if err != nil {
+		return err
+	}
+	writer, err := content.SendResultChunked(&trailerResult{Name: "dump"})
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	var size int64
+	for i := 0; i < 4; i++ {
+		data := bytes.Repeat([]byte{byte('a' + i)}, 1000)
+		hash.Write(data)
+		_, err = writer.Write(data)
+		if err != nil {
+			return err
+		}
+		size += int64(len(data))
+	}
+	err = content.SetResponseTrailer(NewMetadata("x-chunks", "4"))
+	if err != nil {
+		return err
+	}
+	result := &trailerSum{
+		Size: size,
+		Sum:  hex.EncodeToString(hash.Sum(nil)),
+	}
+	return content.SendTrailer(result, nil)
+}
+
+func brokenHandler(content *Content) error {
+	var err error
+	err = content.EnableTrailer()
+	if err != nil {
+		return err
+	}
+	writer, err := content.SendResultChunked(&trailerResult{Name: "dump"})
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write([]byte("partial data"))
+	if err != nil {
+		return err
+	}
+	return errors.New("disk failure")
+}
+
+// brokenSizedHandler announces more data than it sends.
+func brokenSizedHandler(content *Content) error {
+	var err error
+	err = content.EnableTrailer()
+	if err != nil {
+		return err
+	}
+	err = content.SendResult(&trailerResult{Name: "dump"}, 40)
+	if err != nil {
+		return err
+	}
+	_, err = content.BinWriter().Write([]byte("0123456789"))
+	if err != nil {
+		return err
+	}
+	return errors.New("disk failure")
+}
+
+func TestTrailer(t *testing.T) {
+	serv := NewService()
+	serv.Handler(trailerMethod, trailerHandler)
+	serv.Handler(brokenMethod, brokenHandler)
+	serv.Handler(brokenSizedMethod, brokenSizedHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	writer := bytes.NewBuffer(nil)
+	result := &trailerResult{}
+	var trailer Metadata
+	err := Get(ctx, address, trailerMethod, writer, nil, result, nil, WithTrailer(&trailer))
+	require.NoError(t, err)
+	sum := sha256.Sum256(writer.Bytes())
+	require.Equal(t, "dump", result.Name)
+	require.Equal(t, int64(writer.Len()), result.Size)
+	require.Equal(t, hex.EncodeToString(sum[:]), result.Sum)
+	require.Equal(t, "4", trailer.Get("x-chunks"))
+
+	// The handler fails after the result is sent.
+	writer.Reset()
+	err = Get(ctx, address, brokenMethod, writer, nil, result, nil)
+	require.Error(t, err)
+	require.Equal(t, "disk failure", err.Error())
+	require.Equal(t, "partial data", writer.String())
+
+	// The data of the known size ends early too.
+	for _, opt := range []CallOption{WithCodec(JsonCodec), WithDigest(DigestSHA256, nil)} {
+		writer.Reset()
+		err = Get(ctx, address, brokenSizedMethod, writer, nil, result, nil, opt)
+		require.Error(t, err)
+		require.Equal(t, "disk failure", err.Error())
+		require.Equal(t, "0123456789", writer.String())
+	}
+
+	writer.Reset()
+	result = &trailerResult{}
+	err = LocalGet(ctx, trailerMethod, writer, nil, result, nil, trailerHandler, WithCodec(MsgpackCodec))
+	require.NoError(t, err)
+	require.Equal(t, int64(4000), result.Size)
+
+	err = LocalGet(ctx, brokenMethod, writer, nil, result, nil, brokenHandler, WithCodec(GobCodec))
+	require.Error(t, err)
+
+	writer.Reset()
+	err = LocalGet(ctx, brokenSizedMethod, writer, nil, result, nil, brokenSizedHandler)
+	require.EqualError(t, err, "disk failure")
+}
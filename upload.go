@@ -0,0 +1,405 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the built-in methods of resumable uploads.
+const (
+	UploadCreateMethod string = "rpc.upload.create"
+	UploadInfoMethod   string = "rpc.upload.info"
+	UploadWriteMethod  string = "rpc.upload.write"
+)
+
+// DefaultUploadIdleTimeout is the time an upload write waits for the data
+// before it breaks and frees the session.
+const DefaultUploadIdleTimeout = time.Minute
+
+// UploadInfo describes an upload session. Offset is the number of bytes
+// the server has stored, the session is Done once all bytes are stored
+// and the digest, if any, is verified.
+type UploadInfo struct {
+	Id     string `json:"id"                msgpack:"id"`
+	Name   string `json:"name"              msgpack:"name"`
+	Size   int64  `json:"size"              msgpack:"size"`
+	Offset int64  `json:"offset"            msgpack:"offset"`
+	Digest string `json:"digest,omitempty"  msgpack:"digest,omitempty"`
+	Done   bool   `json:"done"              msgpack:"done"`
+}
+
+// UploadStore keeps the data of upload sessions. The offset of a session
+// is the number of bytes written to it, so the store must keep the bytes
+// written up to a broken connection.
+type UploadStore interface {
+	// Create starts a session and returns its id.
+	Create(info UploadInfo) (string, error)
+	// Info returns the session with its current offset.
+	Info(id string) (UploadInfo, error)
+	// Writer returns the writer of the session data from the offset on.
+	Writer(id string, offset int64) (io.WriteCloser, error)
+	// Reader returns the reader of the session data.
+	Reader(id string) (io.ReadCloser, error)
+	// Commit completes the session which has all its data.
+	Commit(id string) error
+	// Remove drops the session.
+	Remove(id string) error
+}
+
+// UploadFunc is called for a completed upload.
+type UploadFunc func(content *Content, info UploadInfo) error
+
+type uploadIdParams struct {
+	Id string `json:"id"  msgpack:"id"`
+}
+
+type uploadWriteParams struct {
+	Id     string `json:"id"      msgpack:"id"`
+	Offset int64  `json:"offset"  msgpack:"offset"`
+}
+
+// CreateUpload starts an upload session of info.Size bytes and returns
+// the session with the id assigned by the server.
+func CreateUpload(ctx context.Context, address string, info UploadInfo, auth *Auth, opts ...CallOption) (UploadInfo, error) {
+	result := UploadInfo{}
+	err := Exec(ctx, address, UploadCreateMethod, &info, &result, auth, opts...)
+	return result, err
+}
+
+// UploadStatus returns the upload session with the number of bytes the
+// server has.
+func UploadStatus(ctx context.Context, address string, id string, auth *Auth, opts ...CallOption) (UploadInfo, error) {
+	result := UploadInfo{}
+	err := Exec(ctx, address, UploadInfoMethod, &uploadIdParams{Id: id}, &result, auth, opts...)
+	return result, err
+}
+
+// ResumeUpload sends the data of the session which the server does not
+// have yet. reader holds all data of the session.
+func ResumeUpload(ctx context.Context, address string, id string, reader io.ReaderAt, auth *Auth, opts ...CallOption) (UploadInfo, error) {
+	var err error
+	info, err := UploadStatus(ctx, address, id, auth, opts...)
+	if err != nil {
+		return info, err
+	}
+	if info.Done {
+		return info, err
+	}
+	remains := info.Size - info.Offset
+	params := &uploadWriteParams{
+		Id:     id,
+		Offset: info.Offset,
+	}
+	result := UploadInfo{}
+	section := io.NewSectionReader(reader, info.Offset, remains)
+	err = Put(ctx, address, UploadWriteMethod, section, remains, params, &result, auth, opts...)
+	if err != nil {
+		return info, err
+	}
+	return result, err
+}
+
+// Upload sends the data with a new upload session. The returned session
+// keeps its id on error, so that the upload can be resumed.
+func Upload(ctx context.Context, address string, info UploadInfo, reader io.ReaderAt, auth *Auth, opts ...CallOption) (UploadInfo, error) {
+	var err error
+	info, err = CreateUpload(ctx, address, info, auth, opts...)
+	if err != nil {
+		return info, err
+	}
+	result, err := ResumeUpload(ctx, address, info.Id, reader, auth, opts...)
+	if err != nil {
+		return info, err
+	}
+	return result, err
+}
+
+// SetUploadIdleTimeout sets the time an upload write waits for the data.
+// A write of a dead link breaks after it, so that the session can be
+// resumed.
+func (svc *Service) SetUploadIdleTimeout(timeout time.Duration) {
+	svc.upIdle = timeout
+}
+
+// uploadService serves the upload methods of a service.
+type uploadService struct {
+	svc      *Service
+	store    UploadStore
+	complete UploadFunc
+	mutex    sync.Mutex
+	busy     map[string]bool
+}
+
+// EnableUploads registers the methods of resumable uploads which keep
+// the data in store. complete, if not nil, is called for each completed
+// upload.
+func (svc *Service) EnableUploads(store UploadStore, complete UploadFunc) {
+	uploads := &uploadService{
+		svc:      svc,
+		store:    store,
+		complete: complete,
+		busy:     make(map[string]bool),
+	}
+	svc.Handler(UploadCreateMethod, uploads.create,
+		WithDescription("Start an upload session"),
+		WithParams(UploadInfo{}),
+		WithResult(UploadInfo{}))
+	svc.Handler(UploadInfoMethod, uploads.info,
+		WithDescription("Get the state of an upload session"),
+		WithParams(uploadIdParams{}),
+		WithResult(UploadInfo{}))
+	svc.Handler(UploadWriteMethod, uploads.write,
+		WithDescription("Write the data of an upload session"),
+		WithParams(uploadWriteParams{}),
+		WithResult(UploadInfo{}),
+		WithBinaryIn())
+}
+
+func (uploads *uploadService) create(content *Content) error {
+	var err error
+	params := &UploadInfo{}
+	err = content.BindParams(params)
+	if err != nil {
+		return err
+	}
+	if params.Size < 0 {
+		err = errors.New("wrong upload size")
+		return err
+	}
+	if len(params.Digest) > 0 {
+		_, _, err = parseDigest(params.Digest)
+		if err != nil {
+			return err
+		}
+	}
+	info := UploadInfo{
+		Name:   params.Name,
+		Size:   params.Size,
+		Digest: params.Digest,
+	}
+	info.Id, err = uploads.store.Create(info)
+	if err != nil {
+		return err
+	}
+	return content.SendResult(&info, 0)
+}
+
+func (uploads *uploadService) info(content *Content) error {
+	var err error
+	params := &uploadIdParams{}
+	err = content.BindParams(params)
+	if err != nil {
+		return err
+	}
+	info, err := uploads.store.Info(params.Id)
+	if err != nil {
+		return err
+	}
+	return content.SendResult(&info, 0)
+}
+
+func (uploads *uploadService) write(content *Content) error {
+	var err error
+	params := &uploadWriteParams{}
+	err = content.BindParams(params)
+	if err != nil {
+		return err
+	}
+	err = uploads.lock(params.Id)
+	if err != nil {
+		return err
+	}
+	defer uploads.unlock(params.Id)
+
+	info, err := uploads.store.Info(params.Id)
+	if err != nil {
+		return err
+	}
+	if info.Done {
+		err = errors.New("upload is completed")
+		return err
+	}
+	if params.Offset != info.Offset {
+		err = fmt.Errorf("wrong upload offset %d, stored %d", params.Offset, info.Offset)
+		return err
+	}
+	binSize := content.BinSize()
+	if binSize < 0 || info.Offset+binSize > info.Size {
+		err = errors.New("upload data exceeds upload size")
+		return err
+	}
+	writer, err := uploads.store.Writer(info.Id, info.Offset)
+	if err != nil {
+		return err
+	}
+	// The bytes received before an error are kept for the resume.
+	idleWriter, stop := uploads.idleWriter(content, writer)
+	err = content.ReadBin(content.Context(), idleWriter)
+	stop()
+	closeErr := writer.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	info, err = uploads.store.Info(info.Id)
+	if err != nil {
+		return err
+	}
+	if info.Offset == info.Size {
+		err = uploads.commit(content, &info)
+		if err != nil {
+			return err
+		}
+	}
+	return content.SendResult(&info, 0)
+}
+
+// commit verifies the digest of the data and completes the session. A
+// session with wrong data is removed.
+func (uploads *uploadService) commit(content *Content, info *UploadInfo) error {
+	var err error
+	if len(info.Digest) > 0 {
+		err = uploads.verify(info)
+		if err == ErrDigestMismatch {
+			uploads.store.Remove(info.Id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err = uploads.store.Commit(info.Id)
+	if err != nil {
+		return err
+	}
+	info.Done = true
+	if uploads.complete != nil {
+		return uploads.complete(content, *info)
+	}
+	return err
+}
+
+func (uploads *uploadService) verify(info *UploadInfo) error {
+	var err error
+	reader, err := uploads.store.Reader(info.Id)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return checkDigest(reader, info.Digest)
+}
+
+// idleWriter returns the writer which moves the read deadline of the
+// connection on each write, so that the read of the data breaks when no
+// data comes for the idle timeout. The read deadline does not pass the
+// deadline of the call, and stop restores it.
+func (uploads *uploadService) idleWriter(content *Content, writer io.Writer) (io.Writer, func()) {
+	idle := uploads.svc.upIdle
+	conn := content.conn
+	if conn == nil || idle <= 0 {
+		return writer, func() {}
+	}
+	deadline, _ := content.Context().Deadline()
+	iwriter := &idleWriter{
+		writer:   writer,
+		conn:     conn,
+		idle:     idle,
+		deadline: deadline,
+	}
+	iwriter.move()
+	stop := func() {
+		conn.SetReadDeadline(deadline)
+	}
+	return iwriter, stop
+}
+
+type idleWriter struct {
+	writer   io.Writer
+	conn     net.Conn
+	idle     time.Duration
+	deadline time.Time
+}
+
+func (writer *idleWriter) Write(data []byte) (int, error) {
+	written, err := writer.writer.Write(data)
+	writer.move()
+	return written, err
+}
+
+// move sets the read deadline to the idle timeout from now.
+func (writer *idleWriter) move() {
+	next := time.Now().Add(writer.idle)
+	if !writer.deadline.IsZero() && writer.deadline.Before(next) {
+		next = writer.deadline
+	}
+	writer.conn.SetReadDeadline(next)
+}
+
+func (uploads *uploadService) lock(id string) error {
+	var err error
+	uploads.mutex.Lock()
+	defer uploads.mutex.Unlock()
+	if uploads.busy[id] {
+		err = errors.New("upload is in progress")
+		return err
+	}
+	uploads.busy[id] = true
+	return err
+}
+
+func (uploads *uploadService) unlock(id string) {
+	uploads.mutex.Lock()
+	defer uploads.mutex.Unlock()
+	delete(uploads.busy, id)
+}
+
+// checkDigest reads the data up to its end and compares its digest with
+// the digest in the algo:hex form.
+func checkDigest(reader io.Reader, digest string) error {
+	var err error
+	algo, sum, err := parseDigest(digest)
+	if err != nil {
+		return err
+	}
+	hash, err := newDigest(algo)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(hash, reader)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(hash.Sum(nil), sum) {
+		return ErrDigestMismatch
+	}
+	return err
+}
+
+// parseDigest splits a digest in the algo:hex form.
+func parseDigest(value string) (string, []byte, error) {
+	var err error
+	algo, sum, _ := strings.Cut(value, ":")
+	_, err = newDigest(algo)
+	if err != nil {
+		return "", nil, err
+	}
+	hexSum, err := hex.DecodeString(sum)
+	if err != nil {
+		err = fmt.Errorf("wrong digest %s", value)
+		return "", nil, err
+	}
+	return algo, hexSum, err
+}
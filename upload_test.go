@@ -0,0 +1,275 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// breakingReader fails when the data beyond limit is read, which breaks
+// the connection of the call.
+type breakingReader struct {
+	reader io.ReaderAt
+	limit  int64
+}
+
+func (reader *breakingReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	if offset+int64(len(buffer)) > reader.limit {
+		return 0, errors.New("connection lost")
+	}
+	return reader.reader.ReadAt(buffer, offset)
+}
+
+func TestUpload(t *testing.T) {
+	store, err := NewFileUploadStore(t.TempDir())
+	require.NoError(t, err)
+	completed := make(chan UploadInfo, 1)
+	serv := NewService()
+	serv.EnableUploads(store, func(content *Content, info UploadInfo) error {
+		completed <- info
+		return nil
+	})
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data := make([]byte, 1000000)
+	rand.Read(data)
+	sum := sha256.Sum256(data)
+	info := UploadInfo{
+		Name:   "image.iso",
+		Size:   int64(len(data)),
+		Digest: DigestSHA256 + ":" + hex.EncodeToString(sum[:]),
+	}
+
+	// The upload breaks in the middle.
+	reader := &breakingReader{reader: bytes.NewReader(data), limit: 300000}
+	info, err = Upload(ctx, address, info, reader, nil)
+	require.ErrorContains(t, err, "connection lost")
+	require.NotEmpty(t, info.Id)
+
+	require.Eventually(t, func() bool {
+		status, err := UploadStatus(ctx, address, info.Id, nil)
+		return err == nil && status.Offset > 0 && status.Offset <= 300000
+	}, time.Second, 10*time.Millisecond)
+
+	// The write of the wrong offset fails.
+	params := &uploadWriteParams{Id: info.Id, Offset: 1}
+	err = Put(ctx, address, UploadWriteMethod, bytes.NewReader(data[1:10]), 9, params, nil, nil)
+	require.Error(t, err)
+
+	info, err = ResumeUpload(ctx, address, info.Id, bytes.NewReader(data), nil)
+	require.NoError(t, err)
+	require.True(t, info.Done)
+	require.Equal(t, info.Size, info.Offset)
+	require.Equal(t, "image.iso", (<-completed).Name)
+	stored, err := os.ReadFile(store.DataPath(info.Id))
+	require.NoError(t, err)
+	require.Equal(t, data, stored)
+
+	// A completed upload is not written again.
+	info, err = ResumeUpload(ctx, address, info.Id, bytes.NewReader(data), nil)
+	require.NoError(t, err)
+	require.True(t, info.Done)
+
+	// Wrong data drops the session.
+	info = UploadInfo{
+		Size:   int64(len(data)),
+		Digest: DigestSHA256 + ":" + hex.EncodeToString(make([]byte, 32)),
+	}
+	info, err = Upload(ctx, address, info, bytes.NewReader(data), nil)
+	require.EqualError(t, err, ErrDigestMismatch.Error())
+	_, err = UploadStatus(ctx, address, info.Id, nil)
+	require.EqualError(t, err, ErrUploadNotFound.Error())
+
+	_, err = UploadStatus(ctx, address, "../upload", nil)
+	require.EqualError(t, err, ErrUploadNotFound.Error())
+	_, err = CreateUpload(ctx, address, UploadInfo{Digest: "md5:00"}, nil)
+	require.Error(t, err)
+}
+
+// stallingReader returns the data up to limit and then blocks until
+// release is closed, as a link which stops sending.
+type stallingReader struct {
+	reader  io.ReaderAt
+	limit   int64
+	release chan struct{}
+}
+
+func (reader *stallingReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	if offset+int64(len(buffer)) > reader.limit {
+		<-reader.release
+		return 0, errors.New("connection lost")
+	}
+	return reader.reader.ReadAt(buffer, offset)
+}
+
+func TestUploadIdle(t *testing.T) {
+	store, err := NewFileUploadStore(t.TempDir())
+	require.NoError(t, err)
+	serv := NewService()
+	serv.EnableUploads(store, nil)
+	serv.SetUploadIdleTimeout(200 * time.Millisecond)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data := make([]byte, 1000000)
+	rand.Read(data)
+	info, err := CreateUpload(ctx, address, UploadInfo{Size: int64(len(data))}, nil)
+	require.NoError(t, err)
+
+	// The link stops sending in the middle of the write.
+	reader := &stallingReader{
+		reader:  bytes.NewReader(data),
+		limit:   300000,
+		release: make(chan struct{}),
+	}
+	stalled := make(chan error, 1)
+	go func() {
+		_, err := ResumeUpload(ctx, address, info.Id, reader, nil)
+		stalled <- err
+	}()
+	defer func() {
+		close(reader.release)
+		<-stalled
+	}()
+
+	// The write breaks on the idle timeout and frees the session.
+	require.Eventually(t, func() bool {
+		info, err = ResumeUpload(ctx, address, info.Id, bytes.NewReader(data), nil)
+		return err == nil
+	}, 3*time.Second, 50*time.Millisecond)
+	require.True(t, info.Done)
+	stored, err := os.ReadFile(store.DataPath(info.Id))
+	require.NoError(t, err)
+	require.Equal(t, data, stored)
+}
+
+// cutCommit writes the info of a completed session without the rename
+// of its data, as a commit cut by a crash.
+func cutCommit(t *testing.T, store *FileUploadStore, data []byte) string {
+	id, err := store.Create(UploadInfo{Size: int64(len(data))})
+	require.NoError(t, err)
+	writer, err := store.Writer(id, 0)
+	require.NoError(t, err)
+	_, err = writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	info, err := store.readInfo(id)
+	require.NoError(t, err)
+	info.Done = true
+	require.NoError(t, store.writeInfo(info))
+	return id
+}
+
+func TestFileUploadStoreCommit(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileUploadStore(dir)
+	require.NoError(t, err)
+
+	// Info does not touch the files, Reader completes the session.
+	id := cutCommit(t, store, []byte("data"))
+	info, err := store.Info(id)
+	require.NoError(t, err)
+	require.True(t, info.Done)
+	require.Equal(t, int64(4), info.Offset)
+	_, err = os.Stat(store.DataPath(id))
+	require.True(t, os.IsNotExist(err))
+	reader, err := store.Reader(id)
+	require.NoError(t, err)
+	stored, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	require.Equal(t, []byte("data"), stored)
+	require.NoError(t, store.Commit(id))
+
+	// The opening of the store completes the session.
+	id = cutCommit(t, store, []byte("next"))
+	store, err = NewFileUploadStore(dir)
+	require.NoError(t, err)
+	stored, err = os.ReadFile(store.DataPath(id))
+	require.NoError(t, err)
+	require.Equal(t, []byte("next"), stored)
+}
+
+func TestFileUploadStoreRemoveStale(t *testing.T) {
+	store, err := NewFileUploadStore(t.TempDir())
+	require.NoError(t, err)
+	stale, err := store.Create(UploadInfo{Size: 10})
+	require.NoError(t, err)
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(store.partPath(stale), old, old))
+	fresh, err := store.Create(UploadInfo{Size: 10})
+	require.NoError(t, err)
+	done := cutCommit(t, store, []byte("data"))
+	require.NoError(t, store.Commit(done))
+	require.NoError(t, os.Chtimes(store.DataPath(done), old, old))
+
+	require.NoError(t, store.RemoveStale(time.Hour))
+	_, err = store.Info(stale)
+	require.ErrorIs(t, err, ErrUploadNotFound)
+	_, err = store.Info(fresh)
+	require.NoError(t, err)
+	_, err = store.Info(done)
+	require.NoError(t, err)
+}
+
+// deadlineConn records the read deadline of the connection.
+type deadlineConn struct {
+	*FConn
+	deadline time.Time
+}
+
+func (conn *deadlineConn) SetReadDeadline(deadline time.Time) error {
+	conn.deadline = deadline
+	return nil
+}
+
+func TestUploadIdleDeadline(t *testing.T) {
+	serv := NewService()
+	serv.SetUploadIdleTimeout(time.Minute)
+	uploads := &uploadService{svc: serv}
+	_, server := NewFConn()
+	conn := &deadlineConn{FConn: server}
+	content := CreateContent(conn)
+
+	// The idle deadline does not pass the deadline of the call.
+	deadline := time.Now().Add(time.Second)
+	content.ctx, content.cancel = context.WithDeadline(context.Background(), deadline)
+	defer content.cancel()
+	writer, stop := uploads.idleWriter(content, io.Discard)
+	require.True(t, conn.deadline.Equal(deadline))
+	conn.deadline = time.Time{}
+	_, err := writer.Write([]byte("data"))
+	require.NoError(t, err)
+	require.True(t, conn.deadline.Equal(deadline))
+	conn.deadline = time.Time{}
+	stop()
+	require.True(t, conn.deadline.Equal(deadline))
+
+	// A call without deadline is left without deadline.
+	content.ctx, content.cancel = context.WithCancel(context.Background())
+	defer content.cancel()
+	writer, stop = uploads.idleWriter(content, io.Discard)
+	require.WithinDuration(t, time.Now().Add(time.Minute), conn.deadline, time.Second)
+	_, err = writer.Write([]byte("data"))
+	require.NoError(t, err)
+	stop()
+	require.True(t, conn.deadline.IsZero())
+}
@@ -0,0 +1,282 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrUploadNotFound is returned for an unknown upload session.
+var ErrUploadNotFound = errors.New("upload not found")
+
+// FileUploadStore keeps upload sessions in a directory. A session has
+// an info file and a data file, the data file is renamed to its final
+// name after the info of the completed session is written. Sessions are
+// kept until they are removed, RemoveStale drops the abandoned ones.
+type FileUploadStore struct {
+	dir string
+}
+
+// NewFileUploadStore opens the store in dir and completes the sessions
+// committed up to the rename of their data.
+func NewFileUploadStore(dir string) (*FileUploadStore, error) {
+	var err error
+	err = os.MkdirAll(dir, 0750)
+	if err != nil {
+		return nil, err
+	}
+	store := &FileUploadStore{
+		dir: dir,
+	}
+	err = store.recover()
+	if err != nil {
+		return nil, err
+	}
+	return store, err
+}
+
+// recover moves the data of the completed sessions to its final name.
+func (store *FileUploadStore) recover() error {
+	var err error
+	ids, err := store.ids()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		info, err := store.readInfo(id)
+		if err != nil || !info.Done {
+			continue
+		}
+		err = store.moveData(id)
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// ids returns the ids of the sessions of the store.
+func (store *FileUploadStore) ids() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(store.dir, "*.info"))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(paths))
+	for _, path := range paths {
+		ids = append(ids, strings.TrimSuffix(filepath.Base(path), ".info"))
+	}
+	return ids, err
+}
+
+// RemoveStale removes the sessions which are not completed and have
+// received no data for the age.
+func (store *FileUploadStore) RemoveStale(age time.Duration) error {
+	var err error
+	ids, err := store.ids()
+	if err != nil {
+		return err
+	}
+	limit := time.Now().Add(-age)
+	for _, id := range ids {
+		info, err := store.readInfo(id)
+		if err != nil || info.Done {
+			continue
+		}
+		stat, err := os.Stat(store.partPath(id))
+		if err == nil && stat.ModTime().After(limit) {
+			continue
+		}
+		err = store.Remove(id)
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// DataPath returns the path of the data of a completed session.
+func (store *FileUploadStore) DataPath(id string) string {
+	return filepath.Join(store.dir, id+".data")
+}
+
+func (store *FileUploadStore) partPath(id string) string {
+	return filepath.Join(store.dir, id+".part")
+}
+
+func (store *FileUploadStore) infoPath(id string) string {
+	return filepath.Join(store.dir, id+".info")
+}
+
+func (store *FileUploadStore) Create(info UploadInfo) (string, error) {
+	var err error
+	idBytes := make([]byte, 16)
+	_, err = rand.Read(idBytes)
+	if err != nil {
+		return "", err
+	}
+	info.Id = hex.EncodeToString(idBytes)
+	info.Offset = 0
+	info.Done = false
+	file, err := os.OpenFile(store.partPath(info.Id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return "", err
+	}
+	file.Close()
+	err = store.writeInfo(info)
+	if err != nil {
+		return "", err
+	}
+	return info.Id, err
+}
+
+func (store *FileUploadStore) Info(id string) (UploadInfo, error) {
+	var err error
+	info, err := store.readInfo(id)
+	if err != nil {
+		return info, err
+	}
+	if info.Done {
+		info.Offset = info.Size
+		return info, err
+	}
+	stat, err := os.Stat(store.partPath(id))
+	if err != nil {
+		return info, err
+	}
+	info.Offset = stat.Size()
+	return info, err
+}
+
+// Writer drops the data beyond the offset, which the session does not
+// take as stored.
+func (store *FileUploadStore) Writer(id string, offset int64) (io.WriteCloser, error) {
+	var err error
+	err = checkUploadId(id)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(store.partPath(id), os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, err
+	}
+	err = file.Truncate(offset)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, err
+}
+
+func (store *FileUploadStore) Reader(id string) (io.ReadCloser, error) {
+	var err error
+	info, err := store.readInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	if info.Done {
+		err = store.moveData(id)
+		if err != nil {
+			return nil, err
+		}
+		return os.Open(store.DataPath(id))
+	}
+	return os.Open(store.partPath(id))
+}
+
+func (store *FileUploadStore) Commit(id string) error {
+	var err error
+	info, err := store.readInfo(id)
+	if err != nil {
+		return err
+	}
+	info.Done = true
+	err = store.writeInfo(info)
+	if err != nil {
+		return err
+	}
+	return store.moveData(id)
+}
+
+// moveData renames the data of a completed session to its final name. A
+// session committed up to the rename is completed by Reader, Commit or
+// the opening of the store.
+func (store *FileUploadStore) moveData(id string) error {
+	err := os.Rename(store.partPath(id), store.DataPath(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (store *FileUploadStore) Remove(id string) error {
+	var err error
+	err = checkUploadId(id)
+	if err != nil {
+		return err
+	}
+	for _, path := range []string{store.partPath(id), store.DataPath(id), store.infoPath(id)} {
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *FileUploadStore) readInfo(id string) (UploadInfo, error) {
+	var err error
+	info := UploadInfo{}
+	err = checkUploadId(id)
+	if err != nil {
+		return info, err
+	}
+	data, err := os.ReadFile(store.infoPath(id))
+	if os.IsNotExist(err) {
+		return info, ErrUploadNotFound
+	}
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(data, &info)
+	return info, err
+}
+
+// writeInfo replaces the info file at once.
+func (store *FileUploadStore) writeInfo(info UploadInfo) error {
+	var err error
+	info.Offset = 0
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	tempPath := store.infoPath(info.Id) + ".tmp"
+	err = os.WriteFile(tempPath, data, 0640)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempPath, store.infoPath(info.Id))
+}
+
+// checkUploadId keeps the session files in the store directory.
+func checkUploadId(id string) error {
+	_, err := hex.DecodeString(id)
+	if err != nil || len(id) == 0 {
+		return ErrUploadNotFound
+	}
+	return nil
+}
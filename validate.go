@@ -10,12 +10,13 @@ import (
 	"net"
 )
 
-func LocalExec(method string, param, result any, auth *Auth, handler HandlerFunc) error {
+func LocalExec(method string, param, result any, auth *Auth, handler HandlerFunc, opts ...CallOption) error {
 	var err error
 
 	cliConn, srvConn := NewFConn()
 
 	content := CreateContent(cliConn)
+	content.applyOptions(opts)
 	content.reqBlock.Method = method
 
 	if param != nil {
@@ -28,7 +29,7 @@ func LocalExec(method string, param, result any, auth *Auth, handler HandlerFunc
 		content.resBlock.Result = result
 	}
 
-	err = content.createRequest()
+	err = content.createRequest(context.Background())
 	if err != nil {
 		return err
 	}
@@ -48,17 +49,22 @@ func LocalExec(method string, param, result any, auth *Auth, handler HandlerFunc
 	if err != nil {
 		return err
 	}
+	err = content.readTrailer()
+	if err != nil {
+		return err
+	}
 
 	return err
 }
 
-func LocalPut(ctx context.Context, method string, reader io.Reader, size int64, param, result any, auth *Auth, handler HandlerFunc) error {
+func LocalPut(ctx context.Context, method string, reader io.Reader, size int64, param, result any, auth *Auth, handler HandlerFunc, opts ...CallOption) error {
 
 	var err error
 
 	cliConn, srvConn := NewFConn()
 
 	content := CreateContent(cliConn)
+	content.applyOptions(opts)
 	content.reqBlock.Method = method
 
 	if param != nil {
@@ -72,11 +78,10 @@ func LocalPut(ctx context.Context, method string, reader io.Reader, size int64,
 	}
 
 	content.binReader = reader
-	content.binWriter = cliConn
 
 	content.reqHeader.binSize = size
 
-	err = content.createRequest()
+	err = content.createRequest(ctx)
 	if err != nil {
 		return err
 	}
@@ -100,15 +105,20 @@ func LocalPut(ctx context.Context, method string, reader io.Reader, size int64,
 	if err != nil {
 		return err
 	}
+	err = content.readTrailer()
+	if err != nil {
+		return err
+	}
 	return err
 }
 
-func LocalGet(ctx context.Context, method string, writer io.Writer, param, result any, auth *Auth, handler HandlerFunc) error {
+func LocalGet(ctx context.Context, method string, writer io.Writer, param, result any, auth *Auth, handler HandlerFunc, opts ...CallOption) error {
 	var err error
 
 	cliConn, srvConn := NewFConn()
 
 	content := CreateContent(cliConn)
+	content.applyOptions(opts)
 	content.reqBlock.Method = method
 
 	if param != nil {
@@ -121,10 +131,9 @@ func LocalGet(ctx context.Context, method string, writer io.Writer, param, resul
 		content.resBlock.Result = result
 	}
 
-	content.binReader = cliConn
 	content.binWriter = writer
 
-	err = content.createRequest()
+	err = content.createRequest(ctx)
 	if err != nil {
 		return err
 	}
@@ -149,6 +158,69 @@ func LocalGet(ctx context.Context, method string, writer io.Writer, param, resul
 	if err != nil {
 		return err
 	}
+	err = content.readTrailer()
+	if err != nil {
+		return err
+	}
+	return err
+}
+
+func LocalExchange(ctx context.Context, method string, reader io.Reader, size int64, writer io.Writer, param, result any, auth *Auth, handler HandlerFunc, opts ...CallOption) error {
+	var err error
+
+	cliConn, srvConn := NewFConn()
+
+	content := CreateContent(cliConn)
+	content.applyOptions(opts)
+	content.reqBlock.Method = method
+
+	if param != nil {
+		content.reqBlock.Params = param
+	}
+	if auth != nil {
+		content.reqBlock.Auth = auth
+	}
+	if result != nil {
+		content.resBlock.Result = result
+	}
+
+	content.binReader = reader
+	content.binWriter = writer
+
+	content.reqHeader.binSize = size
+
+	err = content.createRequest(ctx)
+	if err != nil {
+		return err
+	}
+	err = content.writeRequest()
+	if err != nil {
+		return err
+	}
+	err = content.uploadBin(ctx)
+	if err != nil {
+		return err
+	}
+	err = LocalService(srvConn, handler)
+	if err != nil {
+		return err
+	}
+	err = content.readResponse()
+	if err != nil {
+		return err
+	}
+	err = content.downloadBin(ctx)
+	if err != nil {
+		return err
+	}
+	err = content.bindResponse()
+	if err != nil {
+		return err
+	}
+	err = content.readTrailer()
+	if err != nil {
+		return err
+	}
 	return err
 }
 
@@ -171,5 +243,17 @@ func LocalService(conn net.Conn, handler HandlerFunc) error {
 	if err != nil {
 		return err
 	}
-	return handler(content)
+	err = content.setContext(context.Background())
+	defer content.closeContext()
+	if err != nil {
+		return err
+	}
+	err = content.acceptDigest()
+	if err != nil {
+		return err
+	}
+	content.acceptCompression()
+	err = handler(content)
+	content.finishTrailer(err)
+	return err
 }
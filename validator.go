@@ -0,0 +1,276 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FieldError describes a params field which failed validation.
+type FieldError struct {
+	Field   string `json:"field"    msgpack:"field"`
+	Rule    string `json:"rule"     msgpack:"rule"`
+	Message string `json:"message"  msgpack:"message"`
+}
+
+// ValidationError is returned by BindParams and Validate when params do
+// not match their validate tags. The field errors are sent back to the
+// client, where the call returns a ValidationError as well.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (verr *ValidationError) Error() string {
+	msgs := make([]string, 0, len(verr.Fields))
+	for _, field := range verr.Fields {
+		msgs = append(msgs, field.Field+": "+field.Message)
+	}
+	return "invalid params: " + strings.Join(msgs, "; ")
+}
+
+type rule struct {
+	name string
+	arg  string
+}
+
+var regexpCache sync.Map
+var rulesCache sync.Map
+
+// parseRules parses a validate tag such as "required,min=1,max=10".
+// The regexp rule takes the rest of the tag, so it goes last and its
+// pattern may contain commas.
+func parseRules(tag string) []rule {
+	rules := make([]rule, 0)
+	for tag != "" {
+		var item string
+		if strings.HasPrefix(tag, "regexp=") {
+			item, tag = tag, ""
+		} else {
+			item, tag, _ = strings.Cut(tag, ",")
+		}
+		name, arg, _ := strings.Cut(item, "=")
+		rules = append(rules, rule{name: strings.TrimSpace(name), arg: arg})
+	}
+	return rules
+}
+
+// Validate checks the value against the validate struct tags of its
+// fields. Supported rules are required, min, max, len, oneof and regexp;
+// min, max and len apply to the length of strings, slices and maps.
+func Validate(value any) error {
+	var err error
+	fields := make([]FieldError, 0)
+	validateValue(reflect.ValueOf(value), "", &fields)
+	if len(fields) > 0 {
+		err = &ValidationError{Fields: fields}
+		return err
+	}
+	return err
+}
+
+// typeHasRules reports whether the type or a type within it has validate
+// tags, so values of types without rules are not walked.
+func typeHasRules(rtype reflect.Type) bool {
+	cached, ok := rulesCache.Load(rtype)
+	if ok {
+		return cached.(bool)
+	}
+	has := hasRules(rtype, make(map[reflect.Type]bool))
+	rulesCache.Store(rtype, has)
+	return has
+}
+
+// hasRules checks the type and the types within it. A recursive type
+// refers to a type which is being checked, it adds no rules by itself.
+// The results of the inner types depend on the visited types, so only
+// the result of the outer type is cached.
+func hasRules(rtype reflect.Type, visiting map[reflect.Type]bool) bool {
+	cached, ok := rulesCache.Load(rtype)
+	if ok {
+		return cached.(bool)
+	}
+	if visiting[rtype] {
+		return false
+	}
+	visiting[rtype] = true
+	defer delete(visiting, rtype)
+	has := false
+	switch rtype.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		has = hasRules(rtype.Elem(), visiting)
+	case reflect.Interface:
+		has = true
+	case reflect.Struct:
+		for i := 0; i < rtype.NumField() && !has; i++ {
+			field := rtype.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			has = field.Tag.Get("validate") != "" || hasRules(field.Type, visiting)
+		}
+	}
+	return has
+}
+
+func validateValue(value reflect.Value, path string, fields *[]FieldError) {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	if !typeHasRules(value.Type()) {
+		return
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		rtype := value.Type()
+		for i := 0; i < rtype.NumField(); i++ {
+			field := rtype.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := fieldName(field)
+			if name == "" {
+				continue
+			}
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			if field.Anonymous && field.Tag.Get("json") == "" {
+				fieldPath = path
+			}
+			fieldValue := value.Field(i)
+			tag := field.Tag.Get("validate")
+			if tag != "" && tag != "-" {
+				for _, rule := range parseRules(tag) {
+					msg := checkRule(fieldValue, rule)
+					if msg == "" {
+						continue
+					}
+					*fields = append(*fields, FieldError{Field: fieldPath, Rule: rule.name, Message: msg})
+					if rule.name == "required" {
+						break
+					}
+				}
+			}
+			validateValue(fieldValue, fieldPath, fields)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			validateValue(value.Index(i), fmt.Sprintf("%s[%d]", path, i), fields)
+		}
+	case reflect.Map:
+		iter := value.MapRange()
+		for iter.Next() {
+			validateValue(iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key()), fields)
+		}
+	}
+}
+
+func fieldName(field reflect.StructField) string {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name
+}
+
+func checkRule(value reflect.Value, rule rule) string {
+	if rule.name == "required" {
+		if value.IsZero() {
+			return "is required"
+		}
+		return ""
+	}
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+	switch rule.name {
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(rule.arg, 64)
+		if err != nil {
+			return fmt.Sprintf("bad %s rule argument %q", rule.name, rule.arg)
+		}
+		measure, isLen, ok := measureValue(value)
+		if !ok {
+			return ""
+		}
+		what := "value"
+		if isLen {
+			what = "length"
+		}
+		switch {
+		case rule.name == "min" && measure < limit:
+			return fmt.Sprintf("%s must be at least %s", what, rule.arg)
+		case rule.name == "max" && measure > limit:
+			return fmt.Sprintf("%s must be at most %s", what, rule.arg)
+		case rule.name == "len" && measure != limit:
+			return fmt.Sprintf("%s must be %s", what, rule.arg)
+		}
+	case "oneof":
+		actual := fmt.Sprint(value.Interface())
+		for _, option := range strings.Fields(rule.arg) {
+			if actual == option {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of [%s]", rule.arg)
+	case "regexp":
+		if value.Kind() != reflect.String {
+			return ""
+		}
+		re, err := cachedRegexp(rule.arg)
+		if err != nil {
+			return fmt.Sprintf("bad regexp rule argument: %v", err)
+		}
+		if !re.MatchString(value.String()) {
+			return fmt.Sprintf("must match %s", rule.arg)
+		}
+	default:
+		return fmt.Sprintf("unknown rule %s", rule.name)
+	}
+	return ""
+}
+
+func measureValue(value reflect.Value) (float64, bool, bool) {
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len()), true, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(value.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), false, true
+	}
+	return 0, false, false
+}
+
+func cachedRegexp(pattern string) (*regexp.Regexp, error) {
+	cached, ok := regexpCache.Load(pattern)
+	if ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexpCache.Store(pattern, re)
+	return re, err
+}
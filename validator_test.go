@@ -0,0 +1,107 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type validParams struct {
+	Name  string   `json:"name"   validate:"required,min=2,max=8"`
+	Code  string   `json:"code"   validate:"len=3,regexp=^[a-z]{1,3}$"`
+	Level int      `json:"level"  validate:"min=1,max=5"`
+	Mode  string   `json:"mode"   validate:"oneof=read write"`
+	Tags  []string `json:"tags"   validate:"max=2"`
+}
+
+var validMethod = Method[validParams, HelloResult]("valid")
+
+func TestValidate(t *testing.T) {
+	params := &validParams{Name: "bob", Code: "abc", Level: 3, Mode: "read"}
+	require.NoError(t, Validate(params))
+
+	params = &validParams{Code: "ABCD", Level: 9, Mode: "exec", Tags: []string{"a", "b", "c"}}
+	err := Validate(params)
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr))
+
+	rules := make([]string, 0)
+	for _, field := range verr.Fields {
+		rules = append(rules, field.Field+":"+field.Rule)
+	}
+	expected := []string{"name:required", "code:len", "code:regexp", "level:max", "mode:oneof", "tags:max"}
+	require.Equal(t, expected, rules)
+}
+
+type treeParams struct {
+	Children []*treeParams `json:"children"`
+	Name     string        `json:"name"  validate:"required"`
+}
+
+type listNode struct {
+	Next *listNode `json:"next"`
+	Name string    `json:"name"  validate:"required"`
+}
+
+func TestValidateRecursive(t *testing.T) {
+	tree := &treeParams{Name: "root", Children: []*treeParams{{Name: "a"}, {}}}
+	err := Validate(tree)
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, "children[1].name", verr.Fields[0].Field)
+
+	// The type is first met inside a slice of pointers.
+	list := []*listNode{{Name: "a", Next: &listNode{}}}
+	err = Validate(list)
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, "[0].next.name", verr.Fields[0].Field)
+	require.Error(t, Validate(&listNode{Name: "b", Next: &listNode{}}))
+}
+
+func TestValidateSchema(t *testing.T) {
+	schema := SchemaOf(validParams{})
+	require.Equal(t, []string{"name"}, schema.Required)
+	require.Equal(t, int64(2), *schema.Properties["name"].MinLength)
+	require.Equal(t, float64(5), *schema.Properties["level"].Maximum)
+	require.Equal(t, []any{"read", "write"}, schema.Properties["mode"].Enum)
+	require.Equal(t, "^[a-z]{1,3}$", schema.Properties["code"].Pattern)
+}
+
+func TestValidateNet(t *testing.T) {
+	serv := NewService()
+	serv.SetStrictParams(true)
+	validMethod.Handler(serv, func(content *Content, params *validParams) (*HelloResult, error) {
+		return &HelloResult{Message: params.Name}, nil
+	})
+	serv.Handler(HelloMethod, helloHandler)
+	address := startService(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := &HelloResult{}
+	params := &validParams{Name: "bob", Code: "abc", Level: 3, Mode: "read"}
+	err := Exec(ctx, address, validMethod.Name(), params, result, nil)
+	require.NoError(t, err)
+	require.Equal(t, "bob", result.Message)
+
+	params = &validParams{Code: "abc", Level: 3, Mode: "read"}
+	err = Exec(ctx, address, validMethod.Name(), params, result, nil)
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, []FieldError{{Field: "name", Rule: "required", Message: "is required"}}, verr.Fields)
+
+	// The plain handler returns the binding error without sending it.
+	unknown := map[string]any{"message": "hi", "extra": 1}
+	err = Exec(ctx, address, HelloMethod, unknown, result, nil)
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, "extra", verr.Fields[0].Field)
+	require.Equal(t, "unknown", verr.Fields[0].Rule)
+}